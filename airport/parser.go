@@ -0,0 +1,104 @@
+// Package airport converts the share URIs found in airport subscriptions
+// into Clash proxies. Parsers are registered by URI scheme, other
+// packages may add their own:
+//
+//	func init() {
+//		airport.Register(airport.NewParser("hysteria2", parseHysteria2))
+//	}
+package airport
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Parser converts share URIs of one scheme into Clash proxies. A proxy
+// has at least a name, type, server and port.
+type Parser interface {
+	Scheme() string
+	Parse(uri string) (map[string]interface{}, error)
+}
+
+type funcParser struct {
+	scheme string
+	parse  func(uri string) (map[string]interface{}, error)
+}
+
+func (p funcParser) Scheme() string { return p.scheme }
+
+func (p funcParser) Parse(uri string) (map[string]interface{}, error) { return p.parse(uri) }
+
+// NewParser returns a Parser of scheme calling parse.
+func NewParser(scheme string, parse func(uri string) (map[string]interface{}, error)) Parser {
+	return funcParser{scheme: scheme, parse: parse}
+}
+
+// NoParserError is returned by Parse for a scheme nobody registered.
+type NoParserError struct {
+	Scheme string
+}
+
+func (e *NoParserError) Error() string {
+	return "no parser for scheme " + e.Scheme
+}
+
+var (
+	mu      sync.RWMutex
+	parsers = make(map[string]Parser)
+)
+
+// Register makes p parse the URIs of its scheme. It panics if the
+// scheme is empty or already registered.
+func Register(p Parser) {
+	scheme := strings.ToLower(p.Scheme())
+	if scheme == "" {
+		panic("airport: Register of a parser without scheme")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if _, dup := parsers[scheme]; dup {
+		panic("airport: Register called twice for scheme " + scheme)
+	}
+	parsers[scheme] = p
+}
+
+// Lookup returns the parser registered for scheme.
+func Lookup(scheme string) (Parser, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	p, ok := parsers[strings.ToLower(scheme)]
+	return p, ok
+}
+
+// Schemes returns the registered schemes, sorted.
+func Schemes() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	schemes := make([]string, 0, len(parsers))
+	for scheme := range parsers {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// Parse converts uri with the parser of its scheme. Errors do not quote
+// uri, it carries credentials.
+func Parse(uri string) (map[string]interface{}, error) {
+	scheme, _, ok := strings.Cut(uri, "://")
+	if !ok || scheme == "" {
+		return nil, errors.New("missing scheme")
+	}
+	p, ok := Lookup(scheme)
+	if !ok {
+		return nil, &NoParserError{Scheme: scheme}
+	}
+	m, err := p.Parse(uri)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", strings.ToLower(scheme), err)
+	}
+	return m, nil
+}
@@ -0,0 +1,138 @@
+package airport
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	m, err := Parse("trojan://secret@us.example.net:443?sni=us.example.net#US%2001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{"type": "trojan", "name": "US 01", "password": "secret", "server": "us.example.net", "port": 443, "udp": true}
+	if !reflect.DeepEqual(m, want) {
+		t.Errorf("Parse = %v, want %v", m, want)
+	}
+
+	_, err = Parse("hysteria2://secret@hy.example.net:443#hy")
+	var noParser *NoParserError
+	if !errors.As(err, &noParser) || err.Error() != "no parser for scheme hysteria2" {
+		t.Errorf("unexpected error %v", err)
+	}
+	if _, err := Parse("not a uri"); err == nil || err.Error() != "missing scheme" {
+		t.Errorf("unexpected error %v", err)
+	}
+	if _, err := Parse("ss://secret@hk.example.net:443#hk"); err == nil || !strings.HasPrefix(err.Error(), "ss: ") || strings.Contains(err.Error(), "secret") {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+// TestLookupWrongScheme calls the registered parsers directly, as
+// callers of Lookup may, with URIs lacking their scheme.
+func TestLookupWrongScheme(t *testing.T) {
+	for _, scheme := range []string{"ss", "trojan", "vmess", "vless"} {
+		p, ok := Lookup(scheme)
+		if !ok {
+			t.Fatalf("no parser for %s", scheme)
+		}
+		for _, uri := range []string{"", scheme + ":", scheme + ":/", "http://example.net"} {
+			if m, err := p.Parse(uri); err == nil {
+				t.Errorf("%s parser accepted %q: %v", scheme, uri, m)
+			}
+		}
+		if _, err := p.Parse(strings.ToUpper(scheme) + "://"); err == nil || strings.HasPrefix(err.Error(), "not a ") {
+			t.Errorf("%s parser rejected an upper case scheme: %v", scheme, err)
+		}
+	}
+}
+
+func TestRegister(t *testing.T) {
+	Register(NewParser("test", func(uri string) (map[string]interface{}, error) {
+		return map[string]interface{}{"name": strings.TrimPrefix(uri, "TEST://")}, nil
+	}))
+	defer func() {
+		mu.Lock()
+		delete(parsers, "test")
+		mu.Unlock()
+	}()
+	if m, err := Parse("TEST://node"); err != nil || m["name"] != "node" {
+		t.Errorf("Parse = %v, %v", m, err)
+	}
+	if want := []string{"ss", "test", "trojan", "vless", "vmess"}; !reflect.DeepEqual(Schemes(), want) {
+		t.Errorf("Schemes = %q, want %q", Schemes(), want)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a scheme twice did not panic")
+		}
+	}()
+	Register(NewParser("ss", nil))
+}
+
+var fuzzSeeds = map[string][]string{
+	"ss": {
+		"ss://YWVzLTI1Ni1nY206ZDQxZDhjZDk4ZjAwYjIwNA@hk1.example.net:10001#%F0%9F%87%AD%F0%9F%87%B0%20%E9%A6%99%E6%B8%AF%2001",
+		"ss://YWVzLTI1Ni1nY206ZDQxZDhjZDk4ZjAwYjIwNA==@[2001:db8::1]:8388#IPv6",
+	},
+	"trojan": {
+		"trojan://d41d8cd98f00b204@us1.example.net:443?allowInsecure=0&sni=us1.example.net#US%2001",
+	},
+	"vmess": {
+		"vmess://eyJ2IjogIjIiLCAicHMiOiAiSEsiLCAiYWRkIjogImhrMi5leGFtcGxlLm5ldCIsICJwb3J0IjogIjIwMDAxIiwgImlkIjogImI4MzEzODFkIiwgImFpZCI6ICIwIiwgIm5ldCI6ICJ3cyJ9",
+	},
+	"vless": {
+		"vless://b831381d-6324-4d53-ad4f-8cda48b30811@de1.example.net:443?security=reality&sni=www.example.com&fp=chrome&pbk=SbVKOEMjK0sI&sid=6ba8&type=tcp&flow=xtls-rprx-vision#DE",
+		"vless://b831381d-6324-4d53-ad4f-8cda48b30811@fr1.example.net:443?security=tls&type=ws&host=fr1.example.net&path=%2Fws#FR",
+	},
+}
+
+// fuzzParser checks that the parser of scheme never panics, even when
+// called directly with a URI of another scheme, and that a parsed proxy
+// has what the proxy groups and Clash need.
+func fuzzParser(f *testing.F, scheme string) {
+	p, ok := Lookup(scheme)
+	if !ok {
+		f.Fatalf("no parser for %s", scheme)
+	}
+	for _, seed := range fuzzSeeds[scheme] {
+		f.Add(seed)
+	}
+	f.Add(scheme + "://")
+	f.Add(scheme + "://@:#")
+	f.Add(scheme + ":")
+	f.Add(strings.ToUpper(scheme) + "://")
+	f.Add("")
+	f.Fuzz(func(t *testing.T, uri string) {
+		m, err := p.Parse(uri)
+		if prefix, _, ok := strings.Cut(uri, "://"); !ok || !strings.EqualFold(prefix, scheme) {
+			if err == nil {
+				t.Fatalf("parsed a URI of another scheme: %v", m)
+			}
+			return
+		}
+		if err != nil {
+			return
+		}
+		if name, _ := m["name"].(string); name == "" {
+			t.Fatalf("missing name: %v", m)
+		}
+		if server, _ := m["server"].(string); server == "" {
+			t.Fatalf("missing server: %v", m)
+		}
+		if port, _ := m["port"].(int); port < 1 || port > 65535 {
+			t.Fatalf("invalid port: %v", m)
+		}
+		if _, err := json.Marshal(m); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func FuzzParseSS(f *testing.F)     { fuzzParser(f, "ss") }
+func FuzzParseTrojan(f *testing.F) { fuzzParser(f, "trojan") }
+func FuzzParseVmess(f *testing.F)  { fuzzParser(f, "vmess") }
+func FuzzParseVless(f *testing.F)  { fuzzParser(f, "vless") }
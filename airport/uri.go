@@ -0,0 +1,267 @@
+package airport
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	Register(NewParser("ss", parseSS))
+	Register(NewParser("trojan", parseTrojan))
+	Register(NewParser("vmess", parseVmess))
+	Register(NewParser("vless", parseVless))
+}
+
+// trimScheme returns what follows scheme:// in uri, the scheme is
+// matched case-insensitively.
+func trimScheme(uri, scheme string) (string, error) {
+	s, rest, ok := strings.Cut(uri, "://")
+	if !ok || !strings.EqualFold(s, scheme) {
+		return "", fmt.Errorf("not a %s URI", scheme)
+	}
+	return rest, nil
+}
+
+// decodeBase64 accepts standard and URL-safe alphabets, padded or not.
+func decodeBase64(s string) ([]byte, error) {
+	s = strings.TrimRight(s, "=")
+	b, err := base64.RawStdEncoding.DecodeString(s)
+	if err != nil {
+		b, err = base64.RawURLEncoding.DecodeString(s)
+	}
+	return b, err
+}
+
+func parsePort(s string) (int, error) {
+	port, err := strconv.Atoi(s)
+	if err != nil || port < 1 || port > 65535 {
+		return 0, fmt.Errorf("invalid port %q", s)
+	}
+	return port, nil
+}
+
+func splitHostPort(hostport string) (string, int, error) {
+	host, portStr, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return "", 0, err
+	}
+	if host == "" {
+		return "", 0, errors.New("missing server")
+	}
+	port, err := parsePort(portStr)
+	return host, port, err
+}
+
+func parseName(fragment string) (string, error) {
+	name, err := url.QueryUnescape(fragment)
+	if err != nil {
+		return "", fmt.Errorf("invalid name: %w", err)
+	}
+	if name == "" {
+		return "", errors.New("missing name")
+	}
+	return name, nil
+}
+
+// parseSS parses ss://base64(cipher:password)@server:port#name, plugins
+// are not supported.
+func parseSS(line string) (map[string]interface{}, error) {
+	rest, err := trimScheme(line, "ss")
+	if err != nil {
+		return nil, err
+	}
+	remain, fragment, _ := strings.Cut(rest, "#")
+	userinfo, hostport, ok := strings.Cut(remain, "@")
+	if !ok {
+		return nil, errors.New("missing @")
+	}
+	hostport, query, _ := strings.Cut(hostport, "?")
+	hostport = strings.TrimSuffix(hostport, "/")
+	if strings.Contains(query, "plugin=") {
+		return nil, errors.New("plugins are not supported")
+	}
+	b, err := decodeBase64(userinfo)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user info: %w", err)
+	}
+	cipher, password, ok := strings.Cut(string(b), ":")
+	if !ok || cipher == "" {
+		return nil, errors.New("user info is not cipher:password")
+	}
+	server, port, err := splitHostPort(hostport)
+	if err != nil {
+		return nil, err
+	}
+	name, err := parseName(fragment)
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]interface{})
+	m["type"] = "ss"
+	m["cipher"] = cipher
+	m["password"] = password
+	m["server"] = server
+	m["port"] = port
+	m["name"] = name
+	m["udp"] = true
+	return m, nil
+}
+
+// parseTrojan parses trojan://password@server:port?params#name, the
+// params are ignored.
+func parseTrojan(line string) (map[string]interface{}, error) {
+	rest, err := trimScheme(line, "trojan")
+	if err != nil {
+		return nil, err
+	}
+	remain, fragment, _ := strings.Cut(rest, "#")
+	remain, _, _ = strings.Cut(remain, "?")
+	password, hostport, ok := strings.Cut(remain, "@")
+	if !ok || password == "" {
+		return nil, errors.New("missing password")
+	}
+	server, port, err := splitHostPort(strings.TrimSuffix(hostport, "/"))
+	if err != nil {
+		return nil, err
+	}
+	name, err := parseName(fragment)
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]interface{})
+	m["type"] = "trojan"
+	m["password"] = password
+	m["server"] = server
+	m["port"] = port
+	m["name"] = name
+	m["udp"] = true
+	return m, nil
+}
+
+// parseVmess parses vmess://base64(json), the v2rayN share format.
+// Numbers may be quoted.
+func parseVmess(line string) (map[string]interface{}, error) {
+	rest, err := trimScheme(line, "vmess")
+	if err != nil {
+		return nil, err
+	}
+	b, err := decodeBase64(rest)
+	if err != nil {
+		return nil, err
+	}
+	var mm struct {
+		Ps   string      `json:"ps"`
+		Add  string      `json:"add"`
+		Port json.Number `json:"port"`
+		ID   string      `json:"id"`
+		Aid  json.Number `json:"aid"`
+		Net  string      `json:"net"`
+	}
+	if err := json.Unmarshal(b, &mm); err != nil {
+		return nil, err
+	}
+	if mm.Ps == "" {
+		return nil, errors.New("missing name")
+	}
+	if mm.Add == "" {
+		return nil, errors.New("missing server")
+	}
+	port, err := parsePort(mm.Port.String())
+	if err != nil {
+		return nil, err
+	}
+	alterID := 0
+	if mm.Aid != "" {
+		if alterID, err = strconv.Atoi(mm.Aid.String()); err != nil || alterID < 0 {
+			return nil, fmt.Errorf("invalid aid %q", mm.Aid)
+		}
+	}
+	if mm.Net == "" {
+		mm.Net = "tcp"
+	}
+	m := make(map[string]interface{})
+	m["type"] = "vmess"
+	m["name"] = mm.Ps
+	m["server"] = mm.Add
+	m["port"] = port
+	m["uuid"] = mm.ID
+	m["alterId"] = alterID
+	m["cipher"] = "auto"
+	m["udp"] = true
+	m["network"] = mm.Net
+	return m, nil
+}
+
+// parseVless parses vless://uuid@server:port?params#name.
+func parseVless(line string) (map[string]interface{}, error) {
+	if _, err := trimScheme(line, "vless"); err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(line)
+	if err != nil {
+		// url.Error quotes the line
+		return nil, errors.New("invalid URI")
+	}
+	if u.User == nil || u.User.Username() == "" {
+		return nil, errors.New("missing uuid")
+	}
+	if u.Hostname() == "" {
+		return nil, errors.New("missing server")
+	}
+	port, err := parsePort(u.Port())
+	if err != nil {
+		return nil, err
+	}
+	if u.Fragment == "" {
+		return nil, errors.New("missing name")
+	}
+	m := make(map[string]interface{})
+	m["type"] = "vless"
+	m["name"] = u.Fragment
+	m["server"] = u.Hostname()
+	m["port"] = port
+	m["uuid"] = u.User.Username()
+	m["udp"] = true
+	q := u.Query()
+	network := q.Get("type")
+	if network == "" {
+		network = "tcp"
+	}
+	m["network"] = network
+	switch q.Get("security") {
+	case "tls":
+		m["tls"] = true
+	case "reality":
+		m["tls"] = true
+		m["reality-opts"] = map[string]interface{}{
+			"public-key": q.Get("pbk"),
+			"short-id":   q.Get("sid"),
+		}
+	}
+	if sni := q.Get("sni"); sni != "" {
+		m["servername"] = sni
+	}
+	if flow := q.Get("flow"); flow != "" {
+		m["flow"] = flow
+	}
+	if fp := q.Get("fp"); fp != "" {
+		m["client-fingerprint"] = fp
+	}
+	switch network {
+	case "ws":
+		opts := map[string]interface{}{"path": q.Get("path")}
+		if host := q.Get("host"); host != "" {
+			opts["headers"] = map[string]interface{}{"Host": host}
+		}
+		m["ws-opts"] = opts
+	case "grpc":
+		m["grpc-opts"] = map[string]interface{}{"grpc-service-name": q.Get("serviceName")}
+	}
+	return m, nil
+}
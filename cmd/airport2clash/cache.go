@@ -0,0 +1,131 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// cacheMeta is stored next to each cached subscription body, Source is
+// redacted.
+type cacheMeta struct {
+	Source       string    `json:"source"`
+	FetchedAt    time.Time `json:"fetched_at"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+}
+
+// subscriptionCache keeps the last successful raw subscription of
+// every source URL in Dir. A zero Dir disables caching.
+type subscriptionCache struct {
+	Dir string
+}
+
+func defaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "airport2clash")
+}
+
+func (c *subscriptionCache) paths(source string) (string, string) {
+	sum := sha256.Sum256([]byte(source))
+	key := hex.EncodeToString(sum[:])
+	return filepath.Join(c.Dir, key+".body"), filepath.Join(c.Dir, key+".json")
+}
+
+func (c *subscriptionCache) load(source string) ([]byte, *cacheMeta, error) {
+	if c.Dir == "" {
+		return nil, nil, os.ErrNotExist
+	}
+	bodyPath, metaPath := c.paths(source)
+	b, err := os.ReadFile(metaPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	meta := &cacheMeta{}
+	if err := json.Unmarshal(b, meta); err != nil {
+		return nil, nil, fmt.Errorf("corrupted cache %s: %w", metaPath, err)
+	}
+	body, err := os.ReadFile(bodyPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	return body, meta, nil
+}
+
+func (c *subscriptionCache) store(source string, body []byte, meta *cacheMeta) error {
+	if c.Dir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(c.Dir, 0700); err != nil {
+		return err
+	}
+	bodyPath, metaPath := c.paths(source)
+	b, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(bodyPath, body, 0600); err != nil {
+		return err
+	}
+	return writeFileAtomic(metaPath, b, 0600)
+}
+
+func writeFileAtomic(name string, data []byte, perm os.FileMode) error {
+	tmp := name + ".tmp"
+	if err := os.WriteFile(tmp, data, perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+// loadSubscription fetches source with a conditional request against
+// the cached copy, and returns the decoded subscription. When the fetch
+// or the decoding fails, the cached copy is used with a warning.
+func loadSubscription(source string, opts fetchOptions, cache *subscriptionCache) ([]byte, error) {
+	cachedBody, meta, cacheErr := cache.load(source)
+	if cacheErr != nil && !errors.Is(cacheErr, os.ErrNotExist) {
+		log.Printf("warning: ignoring cache: %s", cacheErr)
+	}
+	if meta != nil {
+		opts.ETag = meta.ETag
+		opts.LastModified = meta.LastModified
+	}
+
+	result, err := fetchSubscription(source, opts)
+	if err == nil && result.NotModified {
+		if cachedBody == nil {
+			return nil, fmt.Errorf("fetch %s: not modified, but no cached copy", redactURL(source))
+		}
+		return decodeSubscription(cachedBody)
+	}
+	var body []byte
+	if err == nil {
+		body, err = decodeSubscription(result.Body)
+	}
+	if err == nil {
+		if err := cache.store(source, result.Body, &cacheMeta{
+			Source:       redactURL(source),
+			FetchedAt:    time.Now(),
+			ETag:         result.ETag,
+			LastModified: result.LastModified,
+		}); err != nil {
+			log.Printf("warning: cannot update cache: %s", err)
+		}
+		return body, nil
+	}
+
+	if cachedBody == nil {
+		return nil, err
+	}
+	log.Printf("warning: %s; falling back to cached copy fetched at %s", redactError(err, source), meta.FetchedAt.Format(time.RFC3339))
+	return decodeSubscription(cachedBody)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadSubscription(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	body := base64.StdEncoding.EncodeToString([]byte("trojan://pw@hk.example.net:443#hk\n"))
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		_, _ = w.Write([]byte(body))
+	}))
+	defer server.Close()
+	source := server.URL + "/sub?token=secret"
+	cache := &subscriptionCache{Dir: filepath.Join(t.TempDir(), "cache")}
+	want := "trojan://pw@hk.example.net:443#hk\n"
+
+	// a fresh fetch is stored
+	got, err := loadSubscription(source, fetchOptions{}, cache)
+	if err != nil || string(got) != want {
+		t.Fatalf("got %q, %v", got, err)
+	}
+	cached, meta, err := cache.load(source)
+	if err != nil || string(cached) != body || meta.ETag != `"v1"` || strings.Contains(meta.Source, "secret") {
+		t.Fatalf("cached %q %+v, %v", cached, meta, err)
+	}
+	if tmp, _ := filepath.Glob(filepath.Join(cache.Dir, "*.tmp")); len(tmp) != 0 {
+		t.Errorf("temporary files left: %q", tmp)
+	}
+
+	// 304 serves the cached body
+	got, err = loadSubscription(source, fetchOptions{}, cache)
+	if err != nil || string(got) != want {
+		t.Fatalf("not modified: got %q, %v", got, err)
+	}
+
+	// a failed fetch falls back to the stale copy
+	status = http.StatusBadGateway
+	logs.Reset()
+	got, err = loadSubscription(source, fetchOptions{}, cache)
+	if err != nil || string(got) != want {
+		t.Fatalf("fallback: got %q, %v", got, err)
+	}
+	if !strings.Contains(logs.String(), "falling back to cached copy") || strings.Contains(logs.String(), "secret") {
+		t.Errorf("log %q", logs.String())
+	}
+
+	// without a cache the error is returned
+	if _, err := loadSubscription(source, fetchOptions{}, &subscriptionCache{}); err == nil {
+		t.Error("no error without a cache")
+	}
+	status = http.StatusOK
+	if _, err := loadSubscription(source, fetchOptions{ETag: `"v1"`}, &subscriptionCache{}); err == nil || !strings.Contains(err.Error(), "no cached copy") {
+		t.Errorf("error %v, want no cached copy", err)
+	}
+
+	// a corrupted cache is ignored
+	_, metaPath := cache.paths(source)
+	if err := os.WriteFile(metaPath, []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	logs.Reset()
+	got, err = loadSubscription(source, fetchOptions{}, cache)
+	if err != nil || string(got) != want || !strings.Contains(logs.String(), "ignoring cache") {
+		t.Errorf("corrupted cache: got %q, %v, log %q", got, err, logs.String())
+	}
+}
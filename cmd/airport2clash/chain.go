@@ -0,0 +1,227 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// chainConfig declares front proxies, such as a self-hosted jump server,
+// and chains taking airport nodes through them, e.g.
+//
+//	proxies:
+//	  - {name: jump, type: ss, server: jump.example.com, port: 8388, cipher: aes-256-gcm, password: secret}
+//	chains:
+//	  - name: 香港中转
+//	    via: jump
+//	    filter: 香港|HK
+//
+// A front proxy may have a dialer-proxy of its own.
+type chainConfig struct {
+	Proxies []map[string]interface{} `yaml:"proxies"`
+	Chains  []chain                  `yaml:"chains"`
+}
+
+// chain takes the airport nodes matching Filter, all if empty, through
+// the front proxy Via. Name is the group selecting between them.
+type chain struct {
+	Name   string `yaml:"name"`
+	Via    string `yaml:"via"`
+	Filter string `yaml:"filter"`
+
+	filter *regexp.Regexp
+}
+
+func loadChainConfig(name string) (*chainConfig, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	c := &chainConfig{}
+	if err := yaml.Unmarshal(b, c); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	front := make(map[string]bool)
+	for i, proxy := range c.Proxies {
+		proxyName, _ := proxy["name"].(string)
+		if proxyName == "" {
+			return nil, fmt.Errorf("%s: proxies[%d]: missing name", name, i)
+		}
+		if front[proxyName] {
+			return nil, fmt.Errorf("%s: proxies[%d]: duplicate name %q", name, i, proxyName)
+		}
+		front[proxyName] = true
+	}
+	for i := range c.Chains {
+		ch := &c.Chains[i]
+		if ch.Name == "" {
+			return nil, fmt.Errorf("%s: chains[%d]: missing name", name, i)
+		}
+		if !front[ch.Via] {
+			return nil, fmt.Errorf("%s: chains[%d]: via %q is not one of the proxies", name, i, ch.Via)
+		}
+		if ch.filter, err = regexp.Compile(ch.Filter); err != nil {
+			return nil, fmt.Errorf("%s: chains[%d]: %w", name, i, err)
+		}
+	}
+	return c, nil
+}
+
+// apply returns the proxies and groups to add for the chains. mihomo
+// dials copies of the nodes through the front proxy with dialer-proxy,
+// the premium core gets a relay group per node. groups are the names of
+// the other proxy groups, which the added names must not reuse.
+func (c *chainConfig) apply(dialect string, proxies []map[string]interface{}, groups []string) ([]map[string]interface{}, []map[string]interface{}, error) {
+	names := make(map[string]bool, len(proxies)+len(groups))
+	for _, proxy := range proxies {
+		names[proxy["name"].(string)] = true
+	}
+	for _, group := range groups {
+		names[group] = true
+	}
+	added := make([]map[string]interface{}, 0, len(c.Proxies))
+	for _, proxy := range c.Proxies {
+		if names[proxy["name"].(string)] {
+			return nil, nil, fmt.Errorf("front proxy %q duplicates an airport node or group", proxy["name"])
+		}
+		names[proxy["name"].(string)] = true
+		added = append(added, proxy)
+	}
+	for _, ch := range c.Chains {
+		if names[ch.Name] {
+			return nil, nil, fmt.Errorf("chain %q duplicates a proxy or group name", ch.Name)
+		}
+		names[ch.Name] = true
+	}
+
+	var selects, relays []map[string]interface{}
+	for _, ch := range c.Chains {
+		var members []string
+		for _, proxy := range proxies {
+			name := proxy["name"].(string)
+			if !ch.filter.MatchString(name) {
+				continue
+			}
+			chained := name + " via " + ch.Via
+			if names[chained] {
+				return nil, nil, fmt.Errorf("chain %q: %q duplicates a proxy or group name", ch.Name, chained)
+			}
+			names[chained] = true
+			if dialect == "meta" {
+				node := make(map[string]interface{}, len(proxy)+1)
+				for k, v := range proxy {
+					node[k] = v
+				}
+				node["name"] = chained
+				node["dialer-proxy"] = ch.Via
+				added = append(added, node)
+			} else {
+				relays = append(relays, map[string]interface{}{
+					"name":    chained,
+					"type":    "relay",
+					"proxies": []string{ch.Via, name},
+				})
+			}
+			members = append(members, chained)
+		}
+		if len(members) == 0 {
+			return nil, nil, fmt.Errorf("chain %q: no node matches %q", ch.Name, ch.Filter)
+		}
+		selects = append(selects, map[string]interface{}{
+			"name":    ch.Name,
+			"type":    "select",
+			"proxies": members,
+		})
+	}
+	return added, append(selects, relays...), nil
+}
+
+func stringList(v interface{}) []string {
+	switch v := v.(type) {
+	case []string:
+		return v
+	case []interface{}:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			list = append(list, fmt.Sprint(item))
+		}
+		return list
+	}
+	return nil
+}
+
+// chainProblems reports dialer-proxy references to unknown proxies and
+// loops through dialer-proxy and group members, e.g. a front proxy
+// dialing through a group that contains nodes chained through it.
+func chainProblems(proxies, groups []map[string]interface{}) []string {
+	edges := make(map[string][]string)
+	known := make(map[string]bool)
+	for _, group := range groups {
+		name, _ := group["name"].(string)
+		known[name] = true
+		edges[name] = stringList(group["proxies"])
+	}
+	var errs []string
+	for _, proxy := range proxies {
+		name, _ := proxy["name"].(string)
+		known[name] = true
+	}
+	for _, proxy := range proxies {
+		name, _ := proxy["name"].(string)
+		if via, ok := proxy["dialer-proxy"].(string); ok {
+			if !known[via] {
+				errs = append(errs, fmt.Sprintf("proxy %q: unknown dialer-proxy %q", name, via))
+				continue
+			}
+			edges[name] = append(edges[name], via)
+		}
+	}
+
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := make(map[string]int)
+	var path []string
+	var visit func(name string) bool
+	visit = func(name string) bool {
+		switch state[name] {
+		case visiting:
+			start := 0
+			for path[start] != name {
+				start++
+			}
+			errs = append(errs, "loop "+strings.Join(append(path[start:], name), " -> "))
+			for _, n := range path {
+				state[n] = done
+			}
+			return true
+		case done:
+			return false
+		}
+		state[name] = visiting
+		path = append(path, name)
+		for _, next := range edges[name] {
+			if visit(next) {
+				return true
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = done
+		return false
+	}
+	for _, proxy := range proxies {
+		name, _ := proxy["name"].(string)
+		path = path[:0]
+		visit(name)
+	}
+	for _, group := range groups {
+		name, _ := group["name"].(string)
+		path = path[:0]
+		visit(name)
+	}
+	return errs
+}
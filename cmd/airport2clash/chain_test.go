@@ -0,0 +1,177 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const chainYaml = `proxies:
+  - {name: jump, type: ss, server: jump.example.com, port: 8388, cipher: aes-256-gcm, password: secret}
+chains:
+  - name: 香港中转
+    via: jump
+    filter: 香港
+`
+
+func writeChainConfig(t *testing.T, content string) string {
+	t.Helper()
+	name := filepath.Join(t.TempDir(), "chain.yaml")
+	if err := os.WriteFile(name, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func chainTestProxies() []map[string]interface{} {
+	return []map[string]interface{}{
+		{"name": "🇭🇰 香港 01", "type": "trojan", "server": "hk1.example.net", "port": 443},
+		{"name": "🇯🇵 日本 01", "type": "trojan", "server": "jp1.example.net", "port": 443},
+		{"name": "🇭🇰 香港 02", "type": "trojan", "server": "hk2.example.net", "port": 443},
+	}
+}
+
+func proxyNames(list []map[string]interface{}) []string {
+	var names []string
+	for _, m := range list {
+		names = append(names, m["name"].(string))
+	}
+	return names
+}
+
+func TestChainApply(t *testing.T) {
+	c, err := loadChainConfig(writeChainConfig(t, chainYaml))
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxies := chainTestProxies()
+
+	added, groups, err := c.apply("meta", proxies, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"jump", "🇭🇰 香港 01 via jump", "🇭🇰 香港 02 via jump"}; !reflect.DeepEqual(proxyNames(added), want) {
+		t.Errorf("meta proxies %q, want %q", proxyNames(added), want)
+	}
+	if added[1]["dialer-proxy"] != "jump" || added[1]["server"] != "hk1.example.net" {
+		t.Errorf("unexpected chained node %v", added[1])
+	}
+	if proxies[0]["dialer-proxy"] != nil {
+		t.Error("the airport node was modified")
+	}
+	if want := []string{"香港中转"}; !reflect.DeepEqual(proxyNames(groups), want) {
+		t.Errorf("meta groups %q, want %q", proxyNames(groups), want)
+	}
+
+	added, groups, err = c.apply("premium", proxies, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"jump"}; !reflect.DeepEqual(proxyNames(added), want) {
+		t.Errorf("premium proxies %q, want %q", proxyNames(added), want)
+	}
+	if want := []string{"香港中转", "🇭🇰 香港 01 via jump", "🇭🇰 香港 02 via jump"}; !reflect.DeepEqual(proxyNames(groups), want) {
+		t.Errorf("premium groups %q, want %q", proxyNames(groups), want)
+	}
+	if relay := groups[1]; relay["type"] != "relay" || !reflect.DeepEqual(relay["proxies"], []string{"jump", "🇭🇰 香港 01"}) {
+		t.Errorf("unexpected relay group %v", relay)
+	}
+	all := append(append([]map[string]interface{}{}, proxies...), added...)
+	if problems := chainProblems(all, groups); problems != nil {
+		t.Errorf("unexpected problems %q", problems)
+	}
+}
+
+func TestChainApplyNameClash(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		proxies []map[string]interface{}
+		groups  []string
+		want    string
+	}{
+		{
+			name:    "chained node",
+			content: chainYaml,
+			proxies: append(chainTestProxies(), map[string]interface{}{"name": "🇭🇰 香港 01 via jump", "type": "ss"}),
+			want:    `chain "香港中转": "🇭🇰 香港 01 via jump" duplicates a proxy or group name`,
+		},
+		{
+			name:    "chained group",
+			content: chainYaml,
+			proxies: chainTestProxies(),
+			groups:  []string{"🇭🇰 香港 02 via jump"},
+			want:    `"🇭🇰 香港 02 via jump" duplicates a proxy or group name`,
+		},
+		{
+			name:    "overlapping chains",
+			content: chainYaml + "  - {name: 全部中转, via: jump}\n",
+			proxies: chainTestProxies(),
+			want:    `chain "全部中转": "🇭🇰 香港 01 via jump" duplicates a proxy or group name`,
+		},
+		{
+			name:    "chain group",
+			content: chainYaml,
+			proxies: chainTestProxies(),
+			groups:  []string{"香港中转"},
+			want:    `chain "香港中转" duplicates a proxy or group name`,
+		},
+		{
+			name:    "front proxy",
+			content: chainYaml,
+			proxies: chainTestProxies(),
+			groups:  []string{"jump"},
+			want:    `front proxy "jump" duplicates an airport node or group`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := loadChainConfig(writeChainConfig(t, tt.content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, dialect := range []string{"meta", "premium"} {
+				if _, _, err := c.apply(dialect, tt.proxies, tt.groups); err == nil || !strings.Contains(err.Error(), tt.want) {
+					t.Errorf("%s: error %v, want %q", dialect, err, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadChainConfigErrors(t *testing.T) {
+	tests := map[string]string{
+		"chains:\n  - {name: a, via: jump}\n":                                          `via "jump" is not one of the proxies`,
+		"proxies:\n  - {type: ss}\n":                                                   "missing name",
+		"proxies:\n  - {name: jump}\nchains:\n  - {via: jump}\n":                       "missing name",
+		"proxies:\n  - {name: jump}\nchains:\n  - {name: a, via: jump, filter: '('}\n": "missing closing )",
+	}
+	for content, want := range tests {
+		_, err := loadChainConfig(writeChainConfig(t, content))
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("loadChainConfig(%q) = %v, want %q", content, err, want)
+		}
+	}
+}
+
+func TestChainProblems(t *testing.T) {
+	proxies := []map[string]interface{}{
+		{"name": "jump", "dialer-proxy": "翻墙机场"},
+		{"name": "hk via jump", "dialer-proxy": "jump"},
+		{"name": "jp", "dialer-proxy": "missing"},
+	}
+	groups := []map[string]interface{}{
+		{"name": "翻墙机场", "proxies": []interface{}{"中转", "jp"}},
+		{"name": "中转", "proxies": []interface{}{"hk via jump"}},
+	}
+	problems := chainProblems(proxies, groups)
+	want := []string{
+		`proxy "jp": unknown dialer-proxy "missing"`,
+		"loop jump -> 翻墙机场 -> 中转 -> hk via jump -> jump",
+	}
+	if !reflect.DeepEqual(problems, want) {
+		t.Errorf("chainProblems = %q, want %q", problems, want)
+	}
+}
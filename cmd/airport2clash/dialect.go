@@ -0,0 +1,155 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// dialects are the client flavors a config can be generated for. meta
+// is Clash.Meta, now mihomo.
+var dialects = []string{"premium", "meta", "clashx"}
+
+// normalizeDialect maps aliases to a name in dialects.
+func normalizeDialect(dialect string) string {
+	switch strings.ToLower(dialect) {
+	case "mihomo", "clash.meta", "clash-meta":
+		return "meta"
+	}
+	return strings.ToLower(dialect)
+}
+
+// metaOnly lists the settings, proxy types, proxy fields and rule types
+// only understood by mihomo.
+var (
+	metaOnlySettings       = []string{"sniffer", "geodata-mode", "geox-url", "geodata-loader", "global-client-fingerprint", "tcp-concurrent", "unified-delay", "find-process-mode"}
+	metaOnlyProxyTypes     = []string{"vless", "hysteria", "hysteria2", "tuic", "wireguard"}
+	metaOnlyProxyFields    = []string{"smux", "client-fingerprint", "reality-opts", "flow", "dialer-proxy"}
+	metaOnlyProviderFields = []string{"filter", "exclude-filter", "exclude-type", "override"}
+	metaOnlyRuleTypes      = []string{"GEOSITE", "DOMAIN-REGEX", "IP-SUFFIX", "IP-ASN", "SRC-GEOIP", "IN-PORT", "NETWORK", "AND", "OR", "NOT"}
+)
+
+// metaSettings are mihomo specific settings added for the meta dialect.
+var metaSettings = map[string]interface{}{
+	"geodata-mode": true,
+	"geox-url": map[string]interface{}{
+		"geoip":   "https://github.com/MetaCubeX/meta-rules-dat/releases/download/latest/geoip.dat",
+		"geosite": "https://github.com/MetaCubeX/meta-rules-dat/releases/download/latest/geosite.dat",
+		"mmdb":    "https://github.com/MetaCubeX/meta-rules-dat/releases/download/latest/country.mmdb",
+	},
+	"sniffer": map[string]interface{}{
+		"enable": true,
+		"sniff": map[string]interface{}{
+			"HTTP": map[string]interface{}{"ports": []interface{}{80, "8080-8880"}, "override-destination": true},
+			"TLS":  map[string]interface{}{"ports": []interface{}{443, 8443}},
+			"QUIC": map[string]interface{}{"ports": []interface{}{443, 8443}},
+		},
+		"skip-domain": []string{"Mijia Cloud", "+.push.apple.com"},
+	},
+}
+
+// applyDialect adds the settings of the dialect. mihomo has dropped
+// redir-host so fake-ip is used instead, ClashX has no tun section.
+func applyDialect(settings *yaml.Node, dialect string) error {
+	if !contains(dialects, dialect) {
+		return fmt.Errorf("unknown dialect %q, expected one of %v", dialect, dialects)
+	}
+	if dialect == "clashx" {
+		// ClashX manages its own enhanced mode
+		return mergeOverlay(settings, map[string]interface{}{"tun": nil})
+	}
+	if dialect != "meta" {
+		return nil
+	}
+	overlay := make(map[string]interface{})
+	for k, v := range metaSettings {
+		overlay[k] = v
+	}
+	if dns := mappingValue(settings, "dns"); dns != nil {
+		if mode := mappingValue(dns, "enhanced-mode"); mode != nil && mode.Value == "redir-host" {
+			overlay["dns"] = map[string]interface{}{
+				"enhanced-mode":  "fake-ip",
+				"fake-ip-filter": fakeIPFilter,
+			}
+		}
+	}
+	return mergeOverlay(settings, overlay)
+}
+
+// proxyOptions are per proxy fields set from flags.
+type proxyOptions struct {
+	ClientFingerprint string
+	Smux              bool
+}
+
+// apply sets the options on every proxy supporting them.
+func (o proxyOptions) apply(proxies []map[string]interface{}) {
+	for _, proxy := range proxies {
+		kind := proxy["type"]
+		if o.ClientFingerprint != "" && (kind == "trojan" || proxy["tls"] == true) {
+			proxy["client-fingerprint"] = o.ClientFingerprint
+		}
+		// xtls flows cannot be multiplexed
+		if o.Smux && proxy["flow"] == nil && (kind == "ss" || kind == "trojan" || kind == "vmess" || kind == "vless") {
+			proxy["smux"] = map[string]interface{}{"enabled": true, "protocol": "h2mux"}
+		}
+	}
+}
+
+// checkDialect rejects settings, proxies and rules the dialect does not
+// support.
+func checkDialect(dialect string, settings *yaml.Node, proxies []map[string]interface{}, rules []string) error {
+	var errs []string
+	if dialect != "meta" {
+		for _, key := range metaOnlySettings {
+			if mappingIndex(settings, key) != -1 {
+				errs = append(errs, fmt.Sprintf("setting %s needs the meta dialect", key))
+			}
+		}
+		for _, proxy := range proxies {
+			if contains(metaOnlyProxyTypes, fmt.Sprint(proxy["type"])) {
+				errs = append(errs, fmt.Sprintf("proxy %q: type %s needs the meta dialect", proxy["name"], proxy["type"]))
+			}
+			for _, field := range metaOnlyProxyFields {
+				if _, ok := proxy[field]; ok {
+					errs = append(errs, fmt.Sprintf("proxy %q: %s needs the meta dialect", proxy["name"], field))
+				}
+			}
+		}
+		if providers := mappingValue(settings, "proxy-providers"); providers != nil {
+			for i := 0; i+1 < len(providers.Content); i += 2 {
+				for _, field := range metaOnlyProviderFields {
+					if mappingIndex(providers.Content[i+1], field) != -1 {
+						errs = append(errs, fmt.Sprintf("proxy provider %q: %s needs the meta dialect", providers.Content[i].Value, field))
+					}
+				}
+			}
+		}
+	}
+	if dns := mappingValue(settings, "dns"); dialect == "meta" && dns != nil {
+		if mode := mappingValue(dns, "enhanced-mode"); mode != nil && mode.Value == "redir-host" {
+			errs = append(errs, "dns.enhanced-mode redir-host is not supported by the meta dialect")
+		}
+	}
+	if tun := mappingValue(settings, "tun"); dialect == "clashx" && tun != nil {
+		errs = append(errs, "tun is not supported by the clashx dialect")
+	}
+	for _, s := range rules {
+		r, err := parseRule(s)
+		if err != nil {
+			continue
+		}
+		if dialect != "meta" && contains(metaOnlyRuleTypes, r.Type) {
+			errs = append(errs, fmt.Sprintf("rule %q needs the meta dialect", s))
+		}
+		if r.Type == "SCRIPT" && dialect != "premium" {
+			errs = append(errs, fmt.Sprintf("rule %q needs the premium dialect", s))
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "\n"))
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestApplyDialectMeta(t *testing.T) {
+	settings := defaultSettings()
+	if err := applyDialect(settings, normalizeDialect("mihomo")); err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "dialect/meta.yaml", []byte(renderSettings(settings)))
+	if err := checkDialect("meta", settings, nil, defaultRules()); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
+
+func TestCheckDialect(t *testing.T) {
+	vless := map[string]interface{}{"name": "v1", "type": "vless", "flow": "xtls-rprx-vision"}
+	tests := []struct {
+		dialect string
+		proxies []map[string]interface{}
+		rules   []string
+		want    []string
+	}{
+		{"premium", []map[string]interface{}{vless}, nil, []string{"type vless needs the meta dialect", "flow needs the meta dialect"}},
+		{"meta", []map[string]interface{}{vless}, nil, []string{"redir-host is not supported"}},
+		{"clashx", nil, []string{"GEOSITE,cn,DIRECT", "SCRIPT,quic,REJECT"}, []string{"needs the meta dialect", "needs the premium dialect"}},
+	}
+	for _, tt := range tests {
+		err := checkDialect(tt.dialect, defaultSettings(), tt.proxies, tt.rules)
+		if err == nil {
+			t.Errorf("%s: expected an error", tt.dialect)
+			continue
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("%s: error %q does not mention %q", tt.dialect, err, want)
+			}
+		}
+	}
+}
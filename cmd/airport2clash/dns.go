@@ -0,0 +1,268 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// dnsConfig is the DNS setup read from -dns, rendered over the dns
+// section of the template, e.g.
+//
+//	default-nameservers: [223.5.5.5, 119.29.29.29]
+//	nameservers: ['https://doh.pub/dns-query', 'https://dns.alidns.com/dns-query']
+//	fallback: ['tls://1.0.0.1:853', 'https://dns.google/dns-query']
+//	internal:
+//	  - domains: [corp.example.com, '+.svc.example.com']
+//	    resolvers: [10.0.0.53]
+//	fake-ip-filter: ['+.printer.lan']
+//	fallback-filter:
+//	  geoip: true
+//	  geoip-code: CN
+//	  ipcidr: [240.0.0.0/4]
+//	  domain: ['+.google.com']
+//
+// Internal domains are resolved by their own resolvers and kept out of
+// the fake-ip pool.
+type dnsConfig struct {
+	DefaultNameservers []string           `yaml:"default-nameservers"`
+	Nameservers        []string           `yaml:"nameservers"`
+	Fallback           []string           `yaml:"fallback"`
+	Internal           []dnsInternal      `yaml:"internal"`
+	FakeIPFilter       []string           `yaml:"fake-ip-filter"`
+	FallbackFilter     *dnsFallbackFilter `yaml:"fallback-filter"`
+}
+
+// dnsInternal is a split-horizon zone.
+type dnsInternal struct {
+	Domains   []string `yaml:"domains"`
+	Resolvers []string `yaml:"resolvers"`
+}
+
+type dnsFallbackFilter struct {
+	GeoIP     *bool    `yaml:"geoip"`
+	GeoIPCode string   `yaml:"geoip-code"`
+	IPCIDR    []string `yaml:"ipcidr"`
+	Domain    []string `yaml:"domain"`
+}
+
+func loadDNSConfig(name string) (*dnsConfig, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	c := &dnsConfig{}
+	decoder := yaml.NewDecoder(strings.NewReader(string(b)))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return c, nil
+}
+
+// checkNameserver validates a Clash nameserver: an IP, an IP with a
+// port such as [2606:4700:4700::1111]:53, udp://, tcp://, tls:// or
+// quic:// with a host and port, an https:// URL, or dhcp://interface.
+// A bootstrap server must not need resolving itself.
+func checkNameserver(s string, bootstrap bool) error {
+	// a bare IPv6 address does not parse as a URL host
+	if _, err := netip.ParseAddr(s); err == nil {
+		return nil
+	}
+	if !strings.Contains(s, "://") {
+		s = "udp://" + s
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return err
+	}
+	switch u.Scheme {
+	case "udp", "tcp", "tls", "quic", "https":
+	case "dhcp":
+		if bootstrap {
+			return errors.New("dhcp cannot bootstrap")
+		}
+		if u.Host == "" {
+			return errors.New("missing interface")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported scheme %s", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return errors.New("missing host")
+	}
+	if port := u.Port(); port != "" {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return fmt.Errorf("invalid port %q", port)
+		}
+	}
+	if u.Scheme != "https" && (u.Path != "" || u.RawQuery != "") {
+		return fmt.Errorf("unexpected path in %s address", u.Scheme)
+	}
+	if bootstrap {
+		if _, err := netip.ParseAddr(u.Hostname()); err != nil {
+			return fmt.Errorf("host %s is not an IP", u.Hostname())
+		}
+	}
+	return nil
+}
+
+// checkDomainPattern validates a domain as used by nameserver-policy and
+// fake-ip-filter, which may start with +. or contain * labels.
+func checkDomainPattern(s string) error {
+	name := strings.TrimPrefix(s, "+.")
+	if name == "" || len(name) > 253 {
+		return errors.New("invalid length")
+	}
+	for _, label := range strings.Split(name, ".") {
+		if label == "" || len(label) > 63 {
+			return errors.New("empty or too long label")
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '*') {
+				return fmt.Errorf("invalid character %q", c)
+			}
+		}
+	}
+	return nil
+}
+
+// validate checks every address, domain and filter, all problems are
+// reported at once. Only mihomo takes several resolvers per domain.
+func (c *dnsConfig) validate(dialect string) error {
+	var errs []string
+	report := func(where string, err error) {
+		errs = append(errs, fmt.Sprintf("%s: %s", where, err))
+	}
+	check := func(key string, list []string, bootstrap bool) {
+		for i, s := range list {
+			if err := checkNameserver(s, bootstrap); err != nil {
+				report(fmt.Sprintf("%s[%d] %q", key, i, s), err)
+			}
+		}
+	}
+	check("default-nameservers", c.DefaultNameservers, true)
+	check("nameservers", c.Nameservers, false)
+	check("fallback", c.Fallback, false)
+	seen := make(map[string]bool)
+	for i, zone := range c.Internal {
+		where := fmt.Sprintf("internal[%d]", i)
+		if len(zone.Domains) == 0 {
+			report(where, errors.New("no domains"))
+		}
+		for j, d := range zone.Domains {
+			if err := checkDomainPattern(d); err != nil {
+				report(fmt.Sprintf("%s.domains[%d] %q", where, j, d), err)
+			}
+			if seen[d] {
+				report(fmt.Sprintf("%s.domains[%d] %q", where, j, d), errors.New("listed twice"))
+			}
+			seen[d] = true
+		}
+		switch {
+		case len(zone.Resolvers) == 0:
+			report(where, errors.New("no resolvers"))
+		case len(zone.Resolvers) > 1 && dialect != "meta":
+			report(where, fmt.Errorf("several resolvers need the meta dialect"))
+		}
+		check(where+".resolvers", zone.Resolvers, false)
+	}
+	for i, d := range c.FakeIPFilter {
+		if err := checkDomainPattern(d); err != nil {
+			report(fmt.Sprintf("fake-ip-filter[%d] %q", i, d), err)
+		}
+	}
+	if f := c.FallbackFilter; f != nil {
+		if f.GeoIPCode != "" && len(f.GeoIPCode) != 2 {
+			report("fallback-filter.geoip-code", fmt.Errorf("%q is not a country code", f.GeoIPCode))
+		}
+		for i, s := range f.IPCIDR {
+			if _, err := netip.ParsePrefix(s); err != nil {
+				report(fmt.Sprintf("fallback-filter.ipcidr[%d]", i), err)
+			}
+		}
+		for i, d := range f.Domain {
+			if err := checkDomainPattern(d); err != nil {
+				report(fmt.Sprintf("fallback-filter.domain[%d] %q", i, d), err)
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+// apply renders the config into the dns section of settings. Lists
+// replace the template ones, except fake-ip-filter which is extended.
+func (c *dnsConfig) apply(settings *yaml.Node) error {
+	dns := make(map[string]interface{})
+	if len(c.DefaultNameservers) > 0 {
+		dns["default-nameserver"] = c.DefaultNameservers
+	}
+	if len(c.Nameservers) > 0 {
+		dns["nameserver"] = c.Nameservers
+	}
+	if len(c.Fallback) > 0 {
+		dns["fallback"] = c.Fallback
+	}
+	policy := make(map[string]interface{})
+	var filter []string
+	if current := mappingValue(settings, "dns"); current != nil {
+		if node := mappingValue(current, "fake-ip-filter"); node != nil {
+			if err := node.Decode(&filter); err != nil {
+				return fmt.Errorf("dns.fake-ip-filter: %w", err)
+			}
+		}
+	}
+	for _, zone := range c.Internal {
+		for _, d := range zone.Domains {
+			if len(zone.Resolvers) == 1 {
+				policy[d] = zone.Resolvers[0]
+			} else {
+				policy[d] = zone.Resolvers
+			}
+			filter = appendMissing(filter, d)
+		}
+	}
+	for _, d := range c.FakeIPFilter {
+		filter = appendMissing(filter, d)
+	}
+	if len(policy) > 0 {
+		dns["nameserver-policy"] = policy
+	}
+	if len(filter) > 0 {
+		dns["fake-ip-filter"] = filter
+	}
+	if f := c.FallbackFilter; f != nil {
+		ff := make(map[string]interface{})
+		if f.GeoIP != nil {
+			ff["geoip"] = *f.GeoIP
+		}
+		if f.GeoIPCode != "" {
+			ff["geoip-code"] = strings.ToUpper(f.GeoIPCode)
+		}
+		if len(f.IPCIDR) > 0 {
+			ff["ipcidr"] = f.IPCIDR
+		}
+		if len(f.Domain) > 0 {
+			ff["domain"] = f.Domain
+		}
+		dns["fallback-filter"] = ff
+	}
+	return mergeOverlay(settings, map[string]interface{}{"dns": dns})
+}
+
+func appendMissing(list []string, s string) []string {
+	if contains(list, s) {
+		return list
+	}
+	return append(list, s)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDNSConfigApply(t *testing.T) {
+	c, err := loadDNSConfig(filepath.Join("testdata", "dns", "split.in.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.validate("meta"); err != nil {
+		t.Fatal(err)
+	}
+	settings := defaultSettings()
+	if err := applyPlatform(settings, "meta", "macos"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.apply(settings); err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, filepath.Join("dns", "split.yaml"), []byte(renderSettings(settings)))
+
+	if err := c.validate("premium"); err == nil || !strings.Contains(err.Error(), "several resolvers need the meta dialect") {
+		t.Errorf("premium: unexpected error %v", err)
+	}
+}
+
+func TestCheckNameserver(t *testing.T) {
+	tests := []struct {
+		s         string
+		bootstrap bool
+		want      string
+	}{
+		{s: "223.5.5.5", bootstrap: true},
+		{s: "2606:4700:4700::1111", bootstrap: true},
+		{s: "[2606:4700:4700::1111]:53", bootstrap: true},
+		{s: "tls://[2606:4700:4700::1111]:853", bootstrap: true},
+		{s: "https://[2606:4700:4700::1111]/dns-query", bootstrap: true},
+		{s: "https://dns.alidns.com/dns-query"},
+		{s: "[2606:4700:4700::1111]:99999", want: "invalid port"},
+		{s: "dns.alidns.com", bootstrap: true, want: "is not an IP"},
+	}
+	for _, tt := range tests {
+		err := checkNameserver(tt.s, tt.bootstrap)
+		if tt.want == "" && err != nil || tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)) {
+			t.Errorf("checkNameserver(%q, %v) = %v, want %q", tt.s, tt.bootstrap, err, tt.want)
+		}
+	}
+}
+
+func TestDNSConfigValidate(t *testing.T) {
+	tests := []struct {
+		config, want string
+	}{
+		{"default-nameservers: ['https://dns.alidns.com/dns-query']", "host dns.alidns.com is not an IP"},
+		{"default-nameservers: ['dhcp://en0']", "dhcp cannot bootstrap"},
+		{"nameservers: ['ftp://1.1.1.1']", "unsupported scheme ftp"},
+		{"nameservers: ['1.1.1.1:99999']", "invalid port"},
+		{"fallback: ['tls://1.1.1.1:853/dns-query']", "unexpected path in tls address"},
+		{"internal: [{domains: [corp.example.com]}]", "no resolvers"},
+		{"internal: [{domains: ['corp..example.com'], resolvers: [10.0.0.53]}]", "empty or too long label"},
+		{"fake-ip-filter: ['bad domain']", "invalid character ' '"},
+		{"fallback-filter: {ipcidr: [240.0.0.0]}", "fallback-filter.ipcidr[0]"},
+		{"fallback-filter: {geoip-code: CHN}", "is not a country code"},
+	}
+	for _, tt := range tests {
+		name := filepath.Join(t.TempDir(), "dns.yaml")
+		if err := os.WriteFile(name, []byte(tt.config), 0600); err != nil {
+			t.Fatal(err)
+		}
+		c, err := loadDNSConfig(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := c.validate("meta"); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got %v, want %q", tt.config, err, tt.want)
+		}
+	}
+
+	name := filepath.Join(t.TempDir(), "dns.yaml")
+	if err := os.WriteFile(name, []byte("nameserver: [1.1.1.1]"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadDNSConfig(name); err == nil {
+		t.Error("expected an error for an unknown key")
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type stringsFlags []string
+
+func (i *stringsFlags) String() string {
+	return strings.Join(*i, ",")
+}
+
+func (i *stringsFlags) Set(value string) error {
+	*i = append(*i, value)
+	return nil
+}
+
+// fetchOptions controls how a subscription is downloaded.
+type fetchOptions struct {
+	Timeout   time.Duration
+	Retries   int
+	Backoff   time.Duration
+	UserAgent string
+	Headers   []string
+	Proxy     string
+
+	// ETag and LastModified make the request conditional.
+	ETag         string
+	LastModified string
+}
+
+// fetchResult is a downloaded subscription along with its validators.
+type fetchResult struct {
+	Body         []byte
+	ETag         string
+	LastModified string
+	NotModified  bool
+}
+
+// statusError reports a non-2xx response from the subscription server,
+// URL is redacted.
+type statusError struct {
+	URL        string
+	StatusCode int
+	Status     string
+	Snippet    string
+}
+
+func (e *statusError) Error() string {
+	msg := fmt.Sprintf("fetch %s: unexpected status %s", e.URL, e.Status)
+	if e.Snippet != "" {
+		msg += fmt.Sprintf(": %q", e.Snippet)
+	}
+	return msg
+}
+
+// retryable reports whether the server may succeed on a later attempt.
+func (e *statusError) retryable() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+func newHTTPClient(opts fetchOptions) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if opts.Proxy != "" {
+		proxyURL, err := url.Parse(opts.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy %q: %w", opts.Proxy, err)
+		}
+		switch proxyURL.Scheme {
+		case "http", "https", "socks5", "socks5h":
+		default:
+			return nil, fmt.Errorf("invalid proxy %q: unsupported scheme %q", opts.Proxy, proxyURL.Scheme)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	return &http.Client{
+		Transport: transport,
+		Timeout:   opts.Timeout,
+	}, nil
+}
+
+func newRequest(source string, opts fetchOptions) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodGet, source, nil)
+	if err != nil {
+		return nil, err
+	}
+	if opts.UserAgent != "" {
+		req.Header.Set("User-Agent", opts.UserAgent)
+	}
+	for _, h := range opts.Headers {
+		idx := strings.Index(h, ":")
+		if idx <= 0 {
+			return nil, fmt.Errorf("invalid header %q, expected \"Key: Value\"", h)
+		}
+		req.Header.Add(strings.TrimSpace(h[0:idx]), strings.TrimSpace(h[idx+1:]))
+	}
+	if opts.ETag != "" {
+		req.Header.Set("If-None-Match", opts.ETag)
+	}
+	if opts.LastModified != "" {
+		req.Header.Set("If-Modified-Since", opts.LastModified)
+	}
+	return req, nil
+}
+
+// fetchSubscription downloads the raw subscription body, retrying
+// network errors and 429/5xx responses with exponential backoff.
+func fetchSubscription(source string, opts fetchOptions) (*fetchResult, error) {
+	client, err := newHTTPClient(opts)
+	if err != nil {
+		return nil, err
+	}
+	var lastErr error
+	for attempt := 0; attempt <= opts.Retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(opts.Backoff << (attempt - 1))
+		}
+		req, err := newRequest(source, opts)
+		if err != nil {
+			return nil, err
+		}
+		result, err := doFetch(client, req)
+		if err == nil {
+			return result, nil
+		}
+		lastErr = err
+		var se *statusError
+		if errors.As(err, &se) && !se.retryable() {
+			break
+		}
+	}
+	return nil, lastErr
+}
+
+func doFetch(client *http.Client, req *http.Request) (*fetchResult, error) {
+	response, err := client.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			urlErr.URL = redactURL(urlErr.URL)
+		}
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode == http.StatusNotModified {
+		return &fetchResult{NotModified: true}, nil
+	}
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		snippet, _ := io.ReadAll(io.LimitReader(response.Body, 256))
+		return nil, &statusError{
+			URL:        redactURL(req.URL.String()),
+			StatusCode: response.StatusCode,
+			Status:     response.Status,
+			Snippet:    strings.TrimSpace(string(snippet)),
+		}
+	}
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	return &fetchResult{
+		Body:         body,
+		ETag:         response.Header.Get("ETag"),
+		LastModified: response.Header.Get("Last-Modified"),
+	}, nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFetchSubscription(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		requests int32
+		status   int
+	}{
+		{name: "ok", statuses: []int{200}, requests: 1},
+		{name: "5xx is retried", statuses: []int{502, 503, 200}, requests: 3},
+		{name: "429 is retried", statuses: []int{429, 200}, requests: 2},
+		{name: "4xx is not retried", statuses: []int{404, 200}, requests: 1, status: 404},
+		{name: "retries run out", statuses: []int{500, 500, 500, 500}, requests: 3, status: 500},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := atomic.AddInt32(&requests, 1)
+				w.WriteHeader(tt.statuses[n-1])
+				_, _ = w.Write([]byte("body"))
+			}))
+			defer server.Close()
+
+			result, err := fetchSubscription(server.URL+"/sub?token=secret", fetchOptions{Retries: 2, Backoff: time.Millisecond})
+			if n := atomic.LoadInt32(&requests); n != tt.requests {
+				t.Errorf("%d requests, want %d", n, tt.requests)
+			}
+			if tt.status == 0 {
+				if err != nil || string(result.Body) != "body" {
+					t.Errorf("got %v, %v", result, err)
+				}
+				return
+			}
+			var se *statusError
+			if !errors.As(err, &se) || se.StatusCode != tt.status {
+				t.Fatalf("error %v, want status %d", err, tt.status)
+			}
+			if se.Snippet != "body" || strings.Contains(se.Error(), "secret") {
+				t.Errorf("error %q", se)
+			}
+		})
+	}
+}
+
+func TestFetchSubscriptionHeaders(t *testing.T) {
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Last-Modified", "Mon, 19 Oct 2026 10:00:00 GMT")
+		_, _ = w.Write([]byte("body"))
+	}))
+	defer server.Close()
+
+	opts := fetchOptions{
+		UserAgent: "clash-verge/v1.3.8",
+		Headers:   []string{"X-Token: abc", "Accept:text/plain"},
+	}
+	result, err := fetchSubscription(server.URL, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.Get("User-Agent") != "clash-verge/v1.3.8" || header.Get("X-Token") != "abc" || header.Get("Accept") != "text/plain" {
+		t.Errorf("sent headers %v", header)
+	}
+	if result.ETag != `"v1"` || result.LastModified != "Mon, 19 Oct 2026 10:00:00 GMT" || result.NotModified {
+		t.Errorf("got %+v", result)
+	}
+
+	opts.ETag, opts.LastModified = result.ETag, result.LastModified
+	result, err = fetchSubscription(server.URL, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.NotModified || header.Get("If-Modified-Since") != opts.LastModified {
+		t.Errorf("got %+v with headers %v", result, header)
+	}
+
+	opts.Headers = []string{"no colon"}
+	if _, err := fetchSubscription(server.URL, opts); err == nil || !strings.Contains(err.Error(), "invalid header") {
+		t.Errorf("error %v, want invalid header", err)
+	}
+}
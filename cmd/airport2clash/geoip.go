@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net"
+	"net/netip"
+	"strings"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// geoIP looks up countries in a MaxMind country database, such as the
+// Country.mmdb shipped with Clash.
+type geoIP struct {
+	reader *maxminddb.Reader
+}
+
+func openGeoIP(name string) (*geoIP, error) {
+	reader, err := maxminddb.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &geoIP{reader: reader}, nil
+}
+
+func (g *geoIP) Close() error {
+	return g.reader.Close()
+}
+
+// Country returns the ISO 3166-1 alpha-2 code of ip, or "" if unknown.
+// Private and loopback addresses are reported as "LAN" the way Clash
+// does.
+func (g *geoIP) Country(ip netip.Addr) string {
+	if ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsUnspecified() {
+		return "LAN"
+	}
+	var record struct {
+		Country struct {
+			ISOCode string `maxminddb:"iso_code"`
+		} `maxminddb:"country"`
+	}
+	if err := g.reader.Lookup(net.IP(ip.AsSlice()), &record); err != nil {
+		return ""
+	}
+	return strings.ToUpper(record.Country.ISOCode)
+}
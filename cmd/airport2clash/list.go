@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// inventoryItem is a node as printed by list.
+type inventoryItem struct {
+	Name      string `json:"name"`
+	Protocol  string `json:"protocol"`
+	Server    string `json:"server"`
+	Port      int    `json:"port"`
+	Transport string `json:"transport"`
+	TLS       bool   `json:"tls"`
+	Region    string `json:"region"`
+}
+
+var inventoryHeader = []string{"name", "protocol", "server", "port", "transport", "tls", "region"}
+
+func (i inventoryItem) fields() []string {
+	return []string{i.Name, i.Protocol, i.Server, strconv.Itoa(i.Port), i.Transport, strconv.FormatBool(i.TLS), i.Region}
+}
+
+// inventory describes the proxies, codes are their regions as returned
+// by regionDetector.detect.
+func inventory(proxies []map[string]interface{}, codes []string) []inventoryItem {
+	items := make([]inventoryItem, 0, len(proxies))
+	for i, proxy := range proxies {
+		item := inventoryItem{Region: codes[i]}
+		item.Name, _ = proxy["name"].(string)
+		item.Protocol, _ = proxy["type"].(string)
+		item.Server, _ = proxy["server"].(string)
+		item.Port, _ = proxy["port"].(int)
+		item.Transport, _ = proxy["network"].(string)
+		if item.Transport == "" {
+			item.Transport = "tcp"
+		}
+		// trojan always runs over TLS
+		item.TLS = proxy["tls"] == true || item.Protocol == "trojan"
+		items = append(items, item)
+	}
+	return items
+}
+
+func writeInventory(w io.Writer, format string, items []inventoryItem) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(items)
+	case "csv":
+		cw := csv.NewWriter(w)
+		_ = cw.Write(inventoryHeader)
+		for _, item := range items {
+			_ = cw.Write(item.fields())
+		}
+		cw.Flush()
+		return cw.Error()
+	case "table":
+		// tabwriter counts runes, CJK and emoji names take two columns
+		rows := [][]string{make([]string, len(inventoryHeader))}
+		for i, h := range inventoryHeader {
+			rows[0][i] = strings.ToUpper(h)
+		}
+		for _, item := range items {
+			rows = append(rows, item.fields())
+		}
+		widths := make([]int, len(inventoryHeader))
+		for _, row := range rows {
+			for i, cell := range row {
+				if w := displayWidth(cell); w > widths[i] {
+					widths[i] = w
+				}
+			}
+		}
+		for _, row := range rows {
+			line := &strings.Builder{}
+			for i, cell := range row {
+				if i == len(row)-1 {
+					line.WriteString(cell)
+				} else {
+					line.WriteString(fit(cell, widths[i]+2))
+				}
+			}
+			if _, err := fmt.Fprintln(w, line.String()); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown format %q, expected json, csv or table", format)
+}
+
+func listMain(args []string) {
+	fs := flag.NewFlagSet("airport2clash list", flag.ExitOnError)
+	var src sourceFlags
+	src.register(fs)
+	format := fs.String("format", "table", "output format: json, csv or table")
+	mmdb := fs.String("mmdb", "", "MaxMind country database, to find the region of nodes without one in their name")
+	resolver := fs.String("resolver", "", "DNS server resolving node servers, e.g. 127.0.0.1:53, defaults to the system resolver")
+	detector := &regionDetector{}
+	fs.IntVar(&detector.Concurrency, "resolve-concurrency", 8, "node servers resolved at once")
+	fs.DurationVar(&detector.Timeout, "resolve-timeout", 5*time.Second, "timeout of resolving a node server")
+	_ = fs.Parse(args)
+
+	if err := src.resolve(); err != nil {
+		panic(err)
+	}
+	proxies, err := src.load()
+	if err != nil {
+		panic(err)
+	}
+	if *mmdb != "" {
+		geo, err := openGeoIP(*mmdb)
+		if err != nil {
+			panic(err)
+		}
+		defer geo.Close()
+		detector.GeoIP = geo
+		detector.Lookup = newLookup(*resolver)
+	}
+	if err := writeInventory(os.Stdout, *format, inventory(proxies, detector.detect(proxies))); err != nil {
+		panic(err)
+	}
+}
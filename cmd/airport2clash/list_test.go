@@ -0,0 +1,36 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteInventory(t *testing.T) {
+	raw, err := os.ReadFile(filepath.Join("testdata", "subscriptions", "mixed.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := decodeSubscription(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxies, err := parseSubscription(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := inventory(proxies, (&regionDetector{}).detect(proxies))
+	for format, ext := range map[string]string{"json": "json", "csv": "csv", "table": "txt"} {
+		t.Run(format, func(t *testing.T) {
+			var b bytes.Buffer
+			if err := writeInventory(&b, format, items); err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, filepath.Join("list", "mixed."+ext), b.Bytes())
+		})
+	}
+	if err := writeInventory(&bytes.Buffer{}, "xml", items); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
@@ -5,44 +5,245 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
-	"io/ioutil"
-	"net/http"
-	"net/url"
-	"strconv"
+	"log"
+	"os"
+	"path/filepath"
 	"strings"
+	"time"
+
+	"github.com/shanexu/sillytools/airport"
 )
 
+// subcommands maps the first argument to its entry point, a bare
+// invocation generates a config.
+var subcommands = map[string]func(args []string){
+	"generate": generateMain,
+	"list":     listMain,
+	"optimize": optimizeMain,
+	"pick":     pickMain,
+	"route":    routeMain,
+	"validate": validateMain,
+}
+
 func main() {
-	source := flag.String("source", "", "source")
+	if len(os.Args) > 1 {
+		if cmd, ok := subcommands[os.Args[1]]; ok {
+			cmd(os.Args[2:])
+			return
+		}
+	}
+	generateMain(os.Args[1:])
+}
 
-	flag.Parse()
+func generateMain(args []string) {
+	fs := flag.NewFlagSet("airport2clash", flag.ExitOnError)
+	var src sourceFlags
+	src.register(fs)
+	stateFile := fs.String("state", defaultStateFile(), "favorites and exclusions saved by pick, empty to ignore")
+	secretFile := fs.String("secret-file", defaultSecretFile(), "keyfile of the external-controller secret, generated on first use, empty to disable")
+	optimize := fs.Bool("optimize", false, "drop duplicate, shadowed and redundant rules")
+	var profiles stringsFlags
+	fs.Var(&profiles, "profile", "profile name or file to layer on the template, may be repeated")
+	profileDir := fs.String("profile-dir", defaultProfileDir(), "directory of named profiles")
+	platform := fs.String("platform", "", "tune tun and DNS settings for linux, macos, windows or router")
+	dialect := fs.String("dialect", "premium", "client flavor: premium, meta (mihomo) or clashx")
+	var proxyOpts proxyOptions
+	fs.StringVar(&proxyOpts.ClientFingerprint, "client-fingerprint", "", "uTLS fingerprint of TLS proxies, e.g. chrome (meta only)")
+	fs.BoolVar(&proxyOpts.Smux, "smux", false, "enable multiplexing on proxies supporting it (meta only)")
+	var providerOpts providerOptions
+	fs.BoolVar(&providerOpts.Enabled, "providers", false, "reference the nodes through proxy-providers instead of inlining them")
+	fs.StringVar(&providerOpts.Name, "provider-name", "airport", "name of the proxy provider")
+	fs.StringVar(&providerOpts.URL, "provider-url", "", "URL Clash fetches the provider from, defaults to -source for meta, token included")
+	fs.StringVar(&providerOpts.File, "provider-file", "", "write the converted nodes to this provider file")
+	fs.IntVar(&providerOpts.Interval, "provider-interval", 86400, "provider refresh interval in seconds")
+	fs.StringVar(&providerOpts.HealthCheckURL, "health-check-url", "http://www.gstatic.com/generate_204", "provider health check URL")
+	fs.IntVar(&providerOpts.HealthInterval, "health-check-interval", 600, "provider health check interval in seconds")
+	fs.StringVar(&providerOpts.Filter, "provider-filter", "", "only keep nodes matching this regexp (meta only)")
+	fs.StringVar(&providerOpts.ExcludeFilter, "provider-exclude-filter", "", "drop nodes matching this regexp (meta only)")
+	renameFlags := fs.Bool("rename-flags", false, "prefix node names with the flag of their region")
+	groupRegions := fs.Bool("region-groups", false, "add a url-test group per region")
+	mmdb := fs.String("mmdb", "", "MaxMind country database, to find the region of nodes without one in their name")
+	resolver := fs.String("resolver", "", "DNS server resolving node servers, e.g. 127.0.0.1:53, defaults to the system resolver")
+	dnsFile := fs.String("dns", "", "YAML file of upstreams, internal domains and filters rendered into the dns section")
+	chainFile := fs.String("chain", "", "YAML file of front proxies and chains taking nodes through them")
+	detector := &regionDetector{}
+	fs.IntVar(&detector.Concurrency, "resolve-concurrency", 8, "node servers resolved at once")
+	fs.DurationVar(&detector.Timeout, "resolve-timeout", 5*time.Second, "timeout of resolving a node server")
 
-	response, err := http.Get(*source)
-	if err != nil {
+	_ = fs.Parse(args)
+
+	if err := src.resolve(); err != nil {
 		panic(err)
 	}
-	defer response.Body.Close()
-	rawBody, err := ioutil.ReadAll(response.Body)
-	if err != nil {
+	*dialect = normalizeDialect(*dialect)
+	settings := defaultSettings()
+	rules := defaultRules()
+	if err := applyDialect(settings, *dialect); err != nil {
 		panic(err)
 	}
-	body, err := base64.StdEncoding.DecodeString(string(rawBody))
+	if *platform != "" {
+		if err := applyPlatform(settings, *dialect, *platform); err != nil {
+			panic(err)
+		}
+	}
+	var chains *chainConfig
+	if *chainFile != "" {
+		var err error
+		if chains, err = loadChainConfig(*chainFile); err != nil {
+			panic(err)
+		}
+	}
+	for _, name := range profiles {
+		p, err := loadProfile(name, *profileDir)
+		if err != nil {
+			panic(err)
+		}
+		rules = p.apply(settings, rules)
+	}
+	if *dnsFile != "" {
+		dns, err := loadDNSConfig(*dnsFile)
+		if err != nil {
+			panic(err)
+		}
+		if err := dns.validate(*dialect); err != nil {
+			panic(fmt.Sprintf("%s: %s", *dnsFile, err))
+		}
+		if err := dns.apply(settings); err != nil {
+			panic(err)
+		}
+	}
+	if *secretFile != "" && mappingIndex(settings, "external-controller") != -1 && mappingIndex(settings, "secret") == -1 {
+		secret, err := loadOrCreateSecret(*secretFile)
+		if err != nil {
+			panic(err)
+		}
+		if err := mergeOverlay(settings, map[string]interface{}{"secret": secret}); err != nil {
+			panic(err)
+		}
+	}
+	if *optimize {
+		rules, _ = optimizeRules(rules)
+	}
+
+	proxies, err := src.load()
 	if err != nil {
 		panic(err)
 	}
-	lines := strings.Split(strings.TrimSpace(string(body)), "\r\n")
-	parser := composeParser(ssParser, trojanParser, vmessParser)
-	proxies := make([]map[string]interface{}, 0)
-	for _, line := range lines {
-		m := parser(line)
-		if m != nil {
-			proxies = append(proxies, m)
-		} else {
-			panic(fmt.Sprintf("cannot parse %q", line))
+	// node changes a provider reading the raw subscription would not see
+	var rewrites []string
+	if *stateFile != "" {
+		state, err := loadPickState(*stateFile)
+		if err != nil {
+			panic(err)
+		}
+		proxies = state.apply(proxies)
+		if len(state.Excluded) > 0 {
+			rewrites = append(rewrites, "the exclusions of "+*stateFile)
+		}
+	}
+	var regional []map[string]interface{}
+	if *renameFlags || *groupRegions {
+		if *groupRegions && providerOpts.Enabled {
+			panic("-region-groups cannot be used with -providers")
 		}
+		if *mmdb != "" {
+			geo, err := openGeoIP(*mmdb)
+			if err != nil {
+				panic(err)
+			}
+			defer geo.Close()
+			detector.GeoIP = geo
+			detector.Lookup = newLookup(*resolver)
+			detector.Cache = &regionCache{TTL: 7 * 24 * time.Hour}
+			if src.CacheDir != "" {
+				detector.Cache.Path = filepath.Join(src.CacheDir, "regions.json")
+			}
+			if err := detector.Cache.load(); err != nil {
+				log.Printf("warning: ignoring cache: %s", err)
+			}
+		}
+		codes := detector.detect(proxies)
+		if detector.Cache != nil {
+			if err := detector.Cache.store(); err != nil {
+				log.Printf("warning: cannot update cache: %s", err)
+			}
+		}
+		if *renameFlags {
+			renameWithFlags(proxies, codes)
+		}
+		if *groupRegions {
+			regional = regionGroups(proxies, codes)
+		}
+	}
+	if *renameFlags {
+		rewrites = append(rewrites, "-rename-flags")
+	}
+	if proxyOpts != (proxyOptions{}) {
+		proxyOpts.apply(proxies)
+		rewrites = append(rewrites, "-client-fingerprint and -smux")
+	}
+	var chained, chainGroups []map[string]interface{}
+	if chains != nil {
+		if providerOpts.Enabled && *dialect != "meta" {
+			panic("-chain with -providers needs the meta dialect")
+		}
+		groups := []string{"翻墙机场", "自动选择", "故障转移"}
+		for _, group := range regional {
+			groups = append(groups, group["name"].(string))
+		}
+		if chained, chainGroups, err = chains.apply(*dialect, proxies, groups); err != nil {
+			panic(err)
+		}
+		rewrites = append(rewrites, "-chain")
+	}
+	var groupNames []string
+	for _, group := range append(regional, chainGroups...) {
+		if group["type"] != "relay" {
+			groupNames = append(groupNames, group["name"].(string))
+		}
+	}
+	proxyGroups := []map[string]interface{}{proxyGroupAirport(proxies, groupNames...), proxyGroupAutoSelect(proxies), proxyGroupFallback(proxies)}
+	proxyGroups = append(proxyGroups, regional...)
+	inlined := proxies
+	if providerOpts.Enabled {
+		provider, err := providerOpts.provider(src.Source, *dialect, rewrites)
+		if err != nil {
+			panic(err)
+		}
+		if providerOpts.File != "" {
+			if err := writeProviderFile(providerOpts.File, proxies); err != nil {
+				panic(err)
+			}
+		}
+		if err := mergeOverlay(settings, map[string]interface{}{
+			"proxy-providers": map[string]interface{}{providerOpts.Name: provider},
+		}); err != nil {
+			panic(err)
+		}
+		for _, proxyGroup := range proxyGroups {
+			useProvider(proxyGroup, providerOpts.Name, proxies)
+		}
+		inlined = nil
+	}
+	proxyGroups = append(proxyGroups, chainGroups...)
+	inlined = append(inlined, chained...)
+	all := append(append([]map[string]interface{}{}, proxies...), chained...)
+	if problems := chainProblems(all, proxyGroups); len(problems) > 0 {
+		panic("proxy chains: " + strings.Join(problems, "\n"))
+	}
+	if err := checkDialect(*dialect, settings, all, rules); err != nil {
+		panic(fmt.Sprintf("dialect %s: %s", *dialect, err))
 	}
 	configYaml := configYamlTmpl
-	proxyGroups := []map[string]interface{}{proxyGroupAirport(proxies), proxyGroupAutoSelect(proxies), proxyGroupFallback(proxies)}
+	configYaml = strings.Replace(configYaml, "{{PROXIES}}", renderProxies(inlined), 1)
+	configYaml = strings.Replace(configYaml, "{{PROXY-GROUPS}}", renderProxies(proxyGroups), 1)
+	configYaml = strings.Replace(configYaml, "{{SETTINGS}}", renderSettings(settings), 1)
+	configYaml = strings.Replace(configYaml, "{{RULES}}", renderRules(rules), 1)
+
+	fmt.Println(configYaml)
+}
+
+func renderProxies(proxies []map[string]interface{}) string {
 	proxiesStr := &strings.Builder{}
 	for _, proxy := range proxies {
 		s, _ := json.Marshal(proxy)
@@ -50,27 +251,26 @@ func main() {
 		proxiesStr.Write(s)
 		proxiesStr.WriteString("\n")
 	}
-	configYaml = strings.Replace(configYaml, "{{PROXIES}}", proxiesStr.String(), 1)
+	return proxiesStr.String()
+}
 
-	proxyGroupsStr := &strings.Builder{}
-	for _, proxyGroup := range proxyGroups {
-		s, _ := json.Marshal(proxyGroup)
-		proxyGroupsStr.WriteString("  - ")
-		proxyGroupsStr.Write(s)
-		proxyGroupsStr.WriteString("\n")
+func decodeSubscription(rawBody []byte) ([]byte, error) {
+	body, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(rawBody)))
+	if err != nil {
+		return nil, fmt.Errorf("subscription is not valid base64: %w", err)
 	}
-	configYaml = strings.Replace(configYaml, "{{PROXY-GROUPS}}", proxyGroupsStr.String(), 1)
-
-	fmt.Println(configYaml)
+	return body, nil
 }
 
-func proxyGroupAirport(proxies []map[string]interface{}) map[string]interface{} {
+// proxyGroupAirport selects between the other groups and the nodes.
+func proxyGroupAirport(proxies []map[string]interface{}, groups ...string) map[string]interface{} {
 	m := make(map[string]interface{})
 	m["name"] = "翻墙机场"
 	m["type"] = "select"
-	names := make([]string, 0, len(proxies)+2)
+	names := make([]string, 0, len(proxies)+len(groups)+2)
 	names = append(names, "自动选择")
 	names = append(names, "故障转移")
+	names = append(names, groups...)
 	for _, proxy := range proxies {
 		name := proxy["name"].(string)
 		names = append(names, name)
@@ -109,111 +309,22 @@ func proxyGroupFallback(proxies []map[string]interface{}) map[string]interface{}
 	return m
 }
 
-func composeParser(parsers ...func(string) map[string]interface{}) func(string) map[string]interface{} {
-	return func(s string) map[string]interface{} {
-		for _, parser := range parsers {
-			m := parser(s)
-			if m != nil {
-				return m
-			}
+// parseSubscription parses the decoded subscription body, one URI per
+// line. Errors do not quote the line, it carries credentials.
+func parseSubscription(body []byte) ([]map[string]interface{}, error) {
+	proxies := make([]map[string]interface{}, 0)
+	for i, line := range strings.Split(string(body), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
 		}
-		return nil
-	}
-}
-
-func ssParser(line string) map[string]interface{} {
-	prefix := "ss://"
-	if !strings.HasPrefix(line, prefix) {
-		return nil
-	}
-	m := make(map[string]interface{})
-	m["type"] = "ss"
-	remain := line[len(prefix):]
-	idx := strings.Index(remain, "@")
-	b, err := base64.StdEncoding.DecodeString(remain[0:idx] + "=")
-	if err != nil {
-		panic(err)
-	}
-	splits := strings.Split(string(b), ":")
-	m["cipher"] = splits[0]
-	m["password"] = splits[1]
-	remain = remain[idx+1:]
-	idx = strings.Index(remain, ":")
-	m["server"] = remain[0:idx]
-	remain = remain[idx+1:]
-	idx = strings.Index(remain, "#")
-	port, err := strconv.Atoi(remain[0:idx])
-	if err != nil {
-		panic(err)
-	}
-	m["port"] = port
-	remain = remain[idx+1:]
-	name, err := url.QueryUnescape(remain)
-	if err != nil {
-		panic(err)
-	}
-	m["name"] = name
-	m["udp"] = true
-	return m
-}
-
-func trojanParser(line string) map[string]interface{} {
-	prefix := "trojan://"
-	if !strings.HasPrefix(line, prefix) {
-		return nil
-	}
-	m := make(map[string]interface{})
-	m["type"] = "trojan"
-	remain := line[len(prefix):]
-	idx := strings.Index(remain, "@")
-	m["password"] = remain[0:idx]
-	remain = remain[idx+1:]
-	idx = strings.Index(remain, ":")
-	m["server"] = remain[0:idx]
-	remain = remain[idx+1:]
-	idx = strings.Index(remain, "?")
-	port, err := strconv.Atoi(remain[0:idx])
-	if err != nil {
-		panic(err)
-	}
-	m["port"] = port
-	remain = remain[idx+1:]
-	idx = strings.Index(remain, "#")
-	remain = remain[idx+1:]
-	name, err := url.QueryUnescape(remain)
-	if err != nil {
-		panic(err)
-	}
-	m["name"] = name
-	m["udp"] = true
-	return m
-}
-
-func vmessParser(line string) map[string]interface{} {
-	prefix := "vmess://"
-	if !strings.HasPrefix(line, prefix) {
-		return nil
-	}
-	m := make(map[string]interface{})
-	m["type"] = "vmess"
-	remain := line[len(prefix):]
-	mm := make(map[string]interface{})
-	b, err := base64.StdEncoding.DecodeString(remain)
-	if err != nil {
-		panic(err)
-	}
-	if err := json.Unmarshal(b, &mm); err != nil {
-		panic(err)
+		m, err := airport.Parse(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		proxies = append(proxies, m)
 	}
-	m["name"] = mm["ps"]
-	m["server"] = mm["add"]
-	m["port"] = mm["port"]
-	m["uuid"] = mm["id"]
-	m["alterId"] = mm["aid"]
-	m["cipher"] = "auto"
-	m["udp"] = true
-	m["network"] = mm["net"]
-	return m
+	return proxies, nil
 }
 
 var configYamlTmpl = `
@@ -226,7 +337,17 @@ var configYamlTmpl = `
 ## 如果您不知道如何操作，请参阅 官方 Github 文档 https://github.com/Dreamacro/clash/blob/dev/README.md
 #---------------------------------------------------#
 
-tun:
+{{SETTINGS}}
+proxies:
+{{PROXIES}}
+proxy-groups:
+{{PROXY-GROUPS}}
+rules:
+{{RULES}}`
+
+// settingsYaml is the settings section of configYamlTmpl, profiles are
+// merged into it.
+var settingsYaml = `tun:
   enable: true
   # device-url: dev://utun # macOS
   device-url: dev://clash0 # Linux
@@ -259,18 +380,10 @@ dns:
   nameserver: ['https://doh.pub/dns-query', 'https://dns.alidns.com/dns-query']
   fallback: ['tls://1.0.0.1:853', 'https://cloudflare-dns.com/dns-query', 'https://dns.google/dns-query']
   fallback-filter: { geoip: true, ipcidr: [240.0.0.0/4, 0.0.0.0/32] }
-  nameserver-policy:
-    '+.sumscope.com': '172.16.65.10'
-
-proxies:
-{{PROXIES}}
-proxy-groups:
-{{PROXY-GROUPS}}
-rules:
-  - 'DOMAIN-SUFFIX,idbhost.com,DIRECT'
+`
 
-  - 'DOMAIN,gfwairport.icu,DIRECT'
-  - 'DOMAIN-SUFFIX,services.googleapis.cn,翻墙机场'
+// defaultRulesYaml is the rules section of configYamlTmpl.
+var defaultRulesYaml = `  - 'DOMAIN-SUFFIX,services.googleapis.cn,翻墙机场'
   - 'DOMAIN-SUFFIX,xn--ngstr-lra8j.com,翻墙机场'
   - 'DOMAIN,safebrowsing.urlsec.qq.com,DIRECT'
   - 'DOMAIN,safebrowsing.googleapis.com,DIRECT'
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+// ruleChange describes a rule removed or flagged by optimizeRules.
+type ruleChange struct {
+	Kind   string // duplicate, shadowed, redundant or conflict
+	Index  int
+	Rule   string
+	By     int
+	ByRule string
+}
+
+func (c ruleChange) String() string {
+	switch c.Kind {
+	case "duplicate":
+		return fmt.Sprintf("removed rules[%d] %q: duplicate of rules[%d]", c.Index, c.Rule, c.By)
+	case "shadowed":
+		return fmt.Sprintf("removed rules[%d] %q: shadowed by rules[%d] %q", c.Index, c.Rule, c.By, c.ByRule)
+	case "redundant":
+		return fmt.Sprintf("removed rules[%d] %q: rules[%d] %q already applies the same policy", c.Index, c.Rule, c.By, c.ByRule)
+	default:
+		return fmt.Sprintf("conflict rules[%d] %q: overrides rules[%d] %q", c.Index, c.Rule, c.By, c.ByRule)
+	}
+}
+
+func isDomainRule(r rule) bool {
+	return r.Type == "DOMAIN" || r.Type == "DOMAIN-SUFFIX" || r.Type == "DOMAIN-KEYWORD"
+}
+
+func isIPRule(r rule) bool {
+	return r.Type == "IP-CIDR" || r.Type == "IP-CIDR6" || r.Type == "GEOIP"
+}
+
+// overlaps reports whether some request may match both a and b. It
+// errs on the side of true.
+func overlaps(a, b rule) bool {
+	if a.covers(b) || b.covers(a) {
+		return true
+	}
+	switch {
+	case isDomainRule(a) && isDomainRule(b):
+		// DOMAIN and DOMAIN-SUFFIX pairs are disjoint unless one covers
+		// the other, keywords may hit anything but an exact domain.
+		return a.Type != "DOMAIN" && b.Type != "DOMAIN" && (a.Type == "DOMAIN-KEYWORD" || b.Type == "DOMAIN-KEYWORD")
+	case isDomainRule(a) && isIPRule(b):
+		return !b.noResolve()
+	case isIPRule(a) && isDomainRule(b):
+		return !a.noResolve()
+	case a.prefix.IsValid() && b.prefix.IsValid():
+		return a.prefix.Overlaps(b.prefix)
+	}
+	return true
+}
+
+// optimizeRules removes duplicate, shadowed and redundant rules without
+// changing which policy any request ends up with, and reports
+// conflicting policies it leaves in place.
+func optimizeRules(raw []string) ([]string, []ruleChange) {
+	rules := make([]rule, len(raw))
+	valid := make([]bool, len(raw))
+	for i, s := range raw {
+		r, err := parseRule(s)
+		rules[i], valid[i] = r, err == nil
+		if !valid[i] {
+			rules[i] = rule{Raw: s}
+		}
+	}
+	var changes []ruleChange
+	removed := make([]bool, len(rules))
+
+	// a rule covered by an earlier one is never reached
+	for j := range rules {
+		if !valid[j] {
+			continue
+		}
+		for i := 0; i < j; i++ {
+			if removed[i] || !valid[i] || !rules[i].covers(rules[j]) {
+				continue
+			}
+			kind := "shadowed"
+			if rules[i].String() == rules[j].String() {
+				kind = "duplicate"
+			}
+			removed[j] = true
+			changes = append(changes, ruleChange{Kind: kind, Index: j, Rule: raw[j], By: i, ByRule: raw[i]})
+			break
+		}
+	}
+
+	// a rule covered by a later one with the same policy is redundant,
+	// unless a rule in between would take some of its requests
+	for i := len(rules) - 1; i >= 0; i-- {
+		if removed[i] || !valid[i] {
+			continue
+		}
+		for j := i + 1; j < len(rules); j++ {
+			if removed[j] || valid[j] && !overlaps(rules[i], rules[j]) {
+				continue
+			}
+			if !valid[j] || rules[j].Target != rules[i].Target {
+				break
+			}
+			if rules[j].covers(rules[i]) {
+				removed[i] = true
+				changes = append(changes, ruleChange{Kind: "redundant", Index: i, Rule: raw[i], By: j, ByRule: raw[j]})
+				break
+			}
+		}
+	}
+
+	// a more specific rule sending requests somewhere else
+	for i := range rules {
+		if removed[i] || !valid[i] {
+			continue
+		}
+		for j := i + 1; j < len(rules); j++ {
+			if !removed[j] && valid[j] && rules[j].Type != "MATCH" && rules[j].Target != rules[i].Target && rules[j].covers(rules[i]) {
+				changes = append(changes, ruleChange{Kind: "conflict", Index: i, Rule: raw[i], By: j, ByRule: raw[j]})
+				break
+			}
+		}
+	}
+
+	optimized := make([]string, 0, len(raw))
+	for i, s := range raw {
+		if !removed[i] {
+			optimized = append(optimized, s)
+		}
+	}
+	return optimized, changes
+}
+
+func optimizeMain(args []string) {
+	fs := flag.NewFlagSet("airport2clash optimize", flag.ExitOnError)
+	configFile := fs.String("config", "", "Clash config to take rules from, defaults to the template rules")
+	reportOnly := fs.Bool("report-only", false, "only print the report")
+	_ = fs.Parse(args)
+
+	raw := defaultRules()
+	if *configFile != "" {
+		config, err := loadClashConfig(*configFile)
+		if err != nil {
+			panic(err)
+		}
+		raw = config.Rules
+	}
+	optimized, changes := optimizeRules(raw)
+	for _, c := range changes {
+		_, _ = fmt.Fprintln(os.Stderr, c)
+	}
+	_, _ = fmt.Fprintf(os.Stderr, "%d rules, %d after optimization\n", len(raw), len(optimized))
+	if *reportOnly {
+		return
+	}
+	fmt.Print("rules:\n" + renderRules(optimized))
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestOptimizeRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   []string
+		want    []string
+		changes []string
+	}{
+		{
+			name:    "duplicate",
+			rules:   []string{"DOMAIN-SUFFIX,google.com,P", "domain-suffix, Google.com ,P", "MATCH,DIRECT"},
+			want:    []string{"DOMAIN-SUFFIX,google.com,P", "MATCH,DIRECT"},
+			changes: []string{`removed rules[1] "domain-suffix, Google.com ,P": duplicate of rules[0]`},
+		},
+		{
+			name:    "shadowed by suffix",
+			rules:   []string{"DOMAIN-SUFFIX,google.com,P", "DOMAIN,www.google.com,DIRECT", "MATCH,DIRECT"},
+			want:    []string{"DOMAIN-SUFFIX,google.com,P", "MATCH,DIRECT"},
+			changes: []string{`removed rules[1] "DOMAIN,www.google.com,DIRECT": shadowed by rules[0] "DOMAIN-SUFFIX,google.com,P"`},
+		},
+		{
+			name:    "shadowed by keyword",
+			rules:   []string{"DOMAIN-KEYWORD,google,P", "DOMAIN-SUFFIX,googleapis.com,DIRECT"},
+			want:    []string{"DOMAIN-KEYWORD,google,P"},
+			changes: []string{`removed rules[1] "DOMAIN-SUFFIX,googleapis.com,DIRECT": shadowed by rules[0] "DOMAIN-KEYWORD,google,P"`},
+		},
+		{
+			name:    "edgekey.net both DIRECT and proxied",
+			rules:   []string{"DOMAIN-SUFFIX,edgekey.net,DIRECT", "DOMAIN-SUFFIX,akamaized.net,翻墙机场", "DOMAIN-SUFFIX,edgekey.net,翻墙机场"},
+			want:    []string{"DOMAIN-SUFFIX,edgekey.net,DIRECT", "DOMAIN-SUFFIX,akamaized.net,翻墙机场"},
+			changes: []string{`removed rules[2] "DOMAIN-SUFFIX,edgekey.net,翻墙机场": shadowed by rules[0] "DOMAIN-SUFFIX,edgekey.net,DIRECT"`},
+		},
+		{
+			name:    "redundant",
+			rules:   []string{"DOMAIN,mail.google.com,P", "DOMAIN-SUFFIX,google.com,P", "MATCH,DIRECT"},
+			want:    []string{"DOMAIN-SUFFIX,google.com,P", "MATCH,DIRECT"},
+			changes: []string{`removed rules[0] "DOMAIN,mail.google.com,P": rules[1] "DOMAIN-SUFFIX,google.com,P" already applies the same policy`},
+		},
+		{
+			name:    "redundant kept behind a conflicting rule",
+			rules:   []string{"DOMAIN-SUFFIX,mail.google.com,P", "DOMAIN-KEYWORD,mail,DIRECT", "DOMAIN-SUFFIX,google.com,P"},
+			want:    []string{"DOMAIN-SUFFIX,mail.google.com,P", "DOMAIN-KEYWORD,mail,DIRECT", "DOMAIN-SUFFIX,google.com,P"},
+			changes: []string{`conflict rules[0] "DOMAIN-SUFFIX,mail.google.com,P": overrides rules[1] "DOMAIN-KEYWORD,mail,DIRECT"`},
+		},
+		{
+			name:  "redundant kept behind a resolving IP rule",
+			rules: []string{"DOMAIN,mail.google.com,P", "IP-CIDR,10.0.0.0/8,DIRECT", "DOMAIN-SUFFIX,google.com,P"},
+			want:  []string{"DOMAIN,mail.google.com,P", "IP-CIDR,10.0.0.0/8,DIRECT", "DOMAIN-SUFFIX,google.com,P"},
+		},
+		{
+			name:    "redundant across a no-resolve IP rule",
+			rules:   []string{"DOMAIN,mail.google.com,P", "IP-CIDR,10.0.0.0/8,DIRECT,no-resolve", "DOMAIN-SUFFIX,google.com,P"},
+			want:    []string{"IP-CIDR,10.0.0.0/8,DIRECT,no-resolve", "DOMAIN-SUFFIX,google.com,P"},
+			changes: []string{`removed rules[0] "DOMAIN,mail.google.com,P": rules[2] "DOMAIN-SUFFIX,google.com,P" already applies the same policy`},
+		},
+		{
+			name:  "redundant kept behind an invalid rule",
+			rules: []string{"DOMAIN,a.example.com,P", "BOGUS,x,DIRECT", "DOMAIN-SUFFIX,example.com,P"},
+			want:  []string{"DOMAIN,a.example.com,P", "BOGUS,x,DIRECT", "DOMAIN-SUFFIX,example.com,P"},
+		},
+		{
+			name:    "itunes.apple.com conflict",
+			rules:   []string{"DOMAIN,itunes.apple.com,翻墙机场", "DOMAIN-SUFFIX,itunes.apple.com,DIRECT", "MATCH,翻墙机场"},
+			want:    []string{"DOMAIN,itunes.apple.com,翻墙机场", "DOMAIN-SUFFIX,itunes.apple.com,DIRECT", "MATCH,翻墙机场"},
+			changes: []string{`conflict rules[0] "DOMAIN,itunes.apple.com,翻墙机场": overrides rules[1] "DOMAIN-SUFFIX,itunes.apple.com,DIRECT"`},
+		},
+		{
+			name:  "MATCH is not a conflict",
+			rules: []string{"DOMAIN-SUFFIX,google.com,DIRECT", "IP-CIDR,10.0.0.0/8,DIRECT,no-resolve", "MATCH,P"},
+			want:  []string{"DOMAIN-SUFFIX,google.com,DIRECT", "IP-CIDR,10.0.0.0/8,DIRECT,no-resolve", "MATCH,P"},
+		},
+		{
+			name:    "redundant with MATCH",
+			rules:   []string{"DOMAIN-SUFFIX,google.com,P", "DOMAIN-SUFFIX,itunes.apple.com,DIRECT", "MATCH,DIRECT"},
+			want:    []string{"DOMAIN-SUFFIX,google.com,P", "MATCH,DIRECT"},
+			changes: []string{`removed rules[1] "DOMAIN-SUFFIX,itunes.apple.com,DIRECT": rules[2] "MATCH,DIRECT" already applies the same policy`},
+		},
+		{
+			name:    "cidr inside cidr",
+			rules:   []string{"IP-CIDR,10.0.0.0/8,DIRECT,no-resolve", "IP-CIDR,10.1.0.0/16,P,no-resolve"},
+			want:    []string{"IP-CIDR,10.0.0.0/8,DIRECT,no-resolve"},
+			changes: []string{`removed rules[1] "IP-CIDR,10.1.0.0/16,P,no-resolve": shadowed by rules[0] "IP-CIDR,10.0.0.0/8,DIRECT,no-resolve"`},
+		},
+		{
+			name:  "no-resolve does not shadow a resolving rule",
+			rules: []string{"IP-CIDR,10.0.0.0/8,DIRECT,no-resolve", "IP-CIDR,10.1.0.0/16,P"},
+			want:  []string{"IP-CIDR,10.0.0.0/8,DIRECT,no-resolve", "IP-CIDR,10.1.0.0/16,P"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, changes := optimizeRules(tt.rules)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("rules = %q, want %q", got, tt.want)
+			}
+			var report []string
+			for _, c := range changes {
+				report = append(report, c.String())
+			}
+			if strings.Join(report, "\n") != strings.Join(tt.changes, "\n") {
+				t.Errorf("changes:\n%s\nwant:\n%s", strings.Join(report, "\n"), strings.Join(tt.changes, "\n"))
+			}
+		})
+	}
+}
+
+// TestOptimizeDefaultRules checks the examples of the embedded rules:
+// itunes.apple.com is proxied as a domain but DIRECT as a suffix, which
+// apple.com already sends DIRECT, and edgekey.net is DIRECT long before
+// it is proxied.
+func TestOptimizeDefaultRules(t *testing.T) {
+	raw := defaultRules()
+	optimized, changes := optimizeRules(raw)
+	var conflict, redundant, shadowed bool
+	for _, c := range changes {
+		if c.Kind == "conflict" && c.Rule == "DOMAIN,itunes.apple.com,翻墙机场" && c.ByRule == "DOMAIN-SUFFIX,apple.com,DIRECT" {
+			conflict = true
+		}
+		if c.Kind == "redundant" && c.Rule == "DOMAIN-SUFFIX,itunes.apple.com,DIRECT" && c.ByRule == "DOMAIN-SUFFIX,apple.com,DIRECT" {
+			redundant = true
+		}
+		if c.Kind == "shadowed" && c.Rule == "DOMAIN-SUFFIX,edgekey.net,翻墙机场" && c.ByRule == "DOMAIN-SUFFIX,edgekey.net,DIRECT" {
+			shadowed = true
+		}
+	}
+	if !conflict {
+		t.Error("itunes.apple.com conflict not reported")
+	}
+	if !redundant {
+		t.Error("redundant itunes.apple.com suffix not removed")
+	}
+	if !shadowed {
+		t.Error("shadowed edgekey.net rule not removed")
+	}
+	kept := make(map[string]bool, len(optimized))
+	for _, s := range optimized {
+		kept[s] = true
+	}
+	if kept["DOMAIN-SUFFIX,edgekey.net,翻墙机场"] || !kept["DOMAIN,itunes.apple.com,翻墙机场"] {
+		t.Error("optimized rules kept the shadowed rule or dropped the conflicting one")
+	}
+	if len(optimized)+countRemoved(changes) != len(raw) {
+		t.Errorf("%d rules left and %d removed out of %d", len(optimized), countRemoved(changes), len(raw))
+	}
+	// optimizing twice changes nothing more
+	again, changes := optimizeRules(optimized)
+	if !reflect.DeepEqual(again, optimized) || countRemoved(changes) != 0 {
+		t.Errorf("second pass removed %d rules", countRemoved(changes))
+	}
+}
+
+func countRemoved(changes []ruleChange) int {
+	n := 0
+	for _, c := range changes {
+		if c.Kind != "conflict" {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestSubscriptions converts testdata/subscriptions/*.txt, raw bodies as
+// served by airports, and compares the proxies and proxy groups with
+// the .yaml next to them.
+func TestSubscriptions(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "subscriptions", "*.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no fixtures")
+	}
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".txt")
+		t.Run(name, func(t *testing.T) {
+			raw, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, err := decodeSubscription(raw)
+			if err != nil {
+				t.Fatal(err)
+			}
+			proxies, err := parseSubscription(body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			groups := []map[string]interface{}{proxyGroupAirport(proxies), proxyGroupAutoSelect(proxies), proxyGroupFallback(proxies)}
+			got := "proxies:\n" + renderProxies(proxies) + "proxy-groups:\n" + renderProxies(groups)
+			checkGolden(t, filepath.Join("subscriptions", name+".yaml"), []byte(got))
+		})
+	}
+}
+
+func TestParseSubscriptionErrors(t *testing.T) {
+	tests := []struct {
+		body, want string
+	}{
+		{"ss://YWVzLTI1Ni1nY206cGFzcw@hk.example.net:10001#hk\nhttp://example.net", "line 2: no parser for scheme http"},
+		{"ss://YWVzLTI1Ni1nY206cGFzcw@hk.example.net#hk", "ss: address hk.example.net: missing port in address"},
+		{"ss://YWVzLTI1Ni1nY206cGFzcw@hk.example.net:10001/?plugin=obfs-local#hk", "ss: plugins are not supported"},
+		{"trojan://secret@us.example.net:0#us", "trojan: invalid port \"0\""},
+		{"trojan://secret@us.example.net:443", "trojan: missing name"},
+		{"vmess://eyJwcyI6ImpwIn0=", "vmess: missing server"},
+		{"vless://uuid@de.example.net:443", "vless: missing name"},
+	}
+	for _, tt := range tests {
+		_, err := parseSubscription([]byte(tt.body))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("parseSubscription(%q) = %v, want %q", tt.body, err, tt.want)
+		}
+		if err != nil && strings.Contains(err.Error(), "secret") {
+			t.Errorf("error %q leaks the password", err)
+		}
+	}
+}
@@ -0,0 +1,438 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// pickNode is a row of the picker.
+type pickNode struct {
+	Name     string
+	Type     string
+	Region   string
+	Server   string
+	Port     int
+	Latency  time.Duration
+	ProbeErr error
+	Favorite bool
+	Excluded bool
+}
+
+func newPickNodes(proxies []map[string]interface{}, state *pickState) []*pickNode {
+	favorites := make(map[string]bool)
+	for _, name := range state.Favorites {
+		favorites[name] = true
+	}
+	excluded := make(map[string]bool)
+	for _, name := range state.Excluded {
+		excluded[name] = true
+	}
+	nodes := make([]*pickNode, 0, len(proxies))
+	for _, proxy := range proxies {
+		n := &pickNode{}
+		n.Name, _ = proxy["name"].(string)
+		n.Type, _ = proxy["type"].(string)
+		n.Server, _ = proxy["server"].(string)
+		n.Port, _ = proxy["port"].(int)
+		n.Region = regionOfName(n.Name)
+		n.Favorite = favorites[n.Name]
+		n.Excluded = excluded[n.Name]
+		nodes = append(nodes, n)
+	}
+	return nodes
+}
+
+// probeLatency measures the TCP handshake with the node, which is what
+// a node close to us costs, not the latency through it.
+func probeLatency(server string, port int, timeout time.Duration) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	var d net.Dialer
+	start := time.Now()
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(server, strconv.Itoa(port)))
+	if err != nil {
+		return 0, err
+	}
+	elapsed := time.Since(start)
+	_ = conn.Close()
+	return elapsed, nil
+}
+
+func probeAll(nodes []*pickNode, concurrency int, timeout time.Duration) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for _, n := range nodes {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(n *pickNode) {
+			defer func() { <-sem; wg.Done() }()
+			n.Latency, n.ProbeErr = probeLatency(n.Server, n.Port, timeout)
+		}(n)
+	}
+	wg.Wait()
+}
+
+type pickAction int
+
+const (
+	pickNone pickAction = iota
+	pickQuit
+	pickSave
+	pickProbe
+)
+
+// pickModel is the state of the picker, kept apart from the terminal.
+type pickModel struct {
+	Nodes   []*pickNode
+	Cursor  int
+	Offset  int
+	Dirty   bool
+	Message string
+
+	// absent keeps the choices about nodes missing from the subscription
+	absent      pickState
+	quitPending bool
+}
+
+func newPickModel(nodes []*pickNode, state *pickState) *pickModel {
+	m := &pickModel{Nodes: nodes}
+	present := make(map[string]bool, len(nodes))
+	for _, n := range nodes {
+		present[n.Name] = true
+	}
+	for _, name := range state.Favorites {
+		if !present[name] {
+			m.absent.Favorites = append(m.absent.Favorites, name)
+		}
+	}
+	for _, name := range state.Excluded {
+		if !present[name] {
+			m.absent.Excluded = append(m.absent.Excluded, name)
+		}
+	}
+	return m
+}
+
+const pickHelp = "↑/↓ j/k move  f favorite  x exclude  l sort by latency  r probe  s save  q quit"
+
+// handle applies a key read by readKey.
+func (m *pickModel) handle(key string) pickAction {
+	quitPending := m.quitPending
+	m.quitPending = false
+	m.Message = ""
+	switch key {
+	case "up", "k":
+		m.move(-1)
+	case "down", "j":
+		m.move(1)
+	case "pgup":
+		m.move(-10)
+	case "pgdn":
+		m.move(10)
+	case "home", "g":
+		m.move(-len(m.Nodes))
+	case "end", "G":
+		m.move(len(m.Nodes))
+	case "f", " ":
+		if n := m.current(); n != nil {
+			n.Favorite = !n.Favorite
+			if n.Favorite {
+				n.Excluded = false
+			}
+			m.Dirty = true
+		}
+	case "x":
+		if n := m.current(); n != nil {
+			n.Excluded = !n.Excluded
+			if n.Excluded {
+				n.Favorite = false
+			}
+			m.Dirty = true
+		}
+	case "l":
+		m.sortByLatency()
+	case "r":
+		return pickProbe
+	case "s":
+		return pickSave
+	case "q", "ctrl-c":
+		if m.Dirty && !quitPending {
+			m.quitPending = true
+			m.Message = "unsaved changes, press q again to discard or s to save"
+			return pickNone
+		}
+		return pickQuit
+	}
+	return pickNone
+}
+
+func (m *pickModel) current() *pickNode {
+	if m.Cursor < 0 || m.Cursor >= len(m.Nodes) {
+		return nil
+	}
+	return m.Nodes[m.Cursor]
+}
+
+func (m *pickModel) move(delta int) {
+	m.Cursor += delta
+	if m.Cursor >= len(m.Nodes) {
+		m.Cursor = len(m.Nodes) - 1
+	}
+	if m.Cursor < 0 {
+		m.Cursor = 0
+	}
+}
+
+// sortByLatency puts the fastest nodes first, unreachable ones last.
+func (m *pickModel) sortByLatency() {
+	current := m.current()
+	sort.SliceStable(m.Nodes, func(i, j int) bool {
+		a, b := m.Nodes[i], m.Nodes[j]
+		if (a.ProbeErr == nil && a.Latency > 0) != (b.ProbeErr == nil && b.Latency > 0) {
+			return a.ProbeErr == nil && a.Latency > 0
+		}
+		return a.Latency < b.Latency
+	})
+	for i, n := range m.Nodes {
+		if n == current {
+			m.Cursor = i
+		}
+	}
+}
+
+// state returns the choices to save.
+func (m *pickModel) state() *pickState {
+	s := &pickState{
+		Favorites: append([]string{}, m.absent.Favorites...),
+		Excluded:  append([]string{}, m.absent.Excluded...),
+	}
+	for _, n := range m.Nodes {
+		if n.Favorite {
+			s.Favorites = append(s.Favorites, n.Name)
+		}
+		if n.Excluded {
+			s.Excluded = append(s.Excluded, n.Name)
+		}
+	}
+	return s
+}
+
+// displayWidth approximates the terminal columns of s, CJK and emoji
+// take two.
+func displayWidth(s string) int {
+	width := 0
+	for _, r := range s {
+		switch {
+		case r >= 0x1100 && r <= 0x115F, r >= 0x2E80 && r <= 0xA4CF, r >= 0xAC00 && r <= 0xD7A3,
+			r >= 0xF900 && r <= 0xFAFF, r >= 0xFE30 && r <= 0xFE4F, r >= 0xFF00 && r <= 0xFF60,
+			r >= 0xFFE0 && r <= 0xFFE6, r >= 0x1F300 && r <= 0x1F64F, r >= 0x1F900 && r <= 0x1F9FF,
+			r >= 0x20000 && r <= 0x3FFFD:
+			width += 2
+		case r < 0x20 || r >= 0xFE00 && r <= 0xFE0F || r == 0x200D:
+		default:
+			width++
+		}
+	}
+	return width
+}
+
+// fit truncates or pads s to width columns.
+func fit(s string, width int) string {
+	if w := displayWidth(s); w <= width {
+		return s + strings.Repeat(" ", width-w)
+	}
+	var b strings.Builder
+	w := 0
+	for _, r := range s {
+		rw := displayWidth(string(r))
+		if w+rw > width-1 {
+			break
+		}
+		b.WriteRune(r)
+		w += rw
+	}
+	b.WriteString("…")
+	return b.String() + strings.Repeat(" ", width-w-1)
+}
+
+func (n *pickNode) latency() string {
+	switch {
+	case n.ProbeErr != nil:
+		return "timeout"
+	case n.Latency == 0:
+		return "-"
+	}
+	return fmt.Sprintf("%dms", n.Latency.Milliseconds())
+}
+
+// render draws the model on a screen of width x height.
+func (m *pickModel) render(w io.Writer, width, height int) {
+	rows := height - 4
+	if rows < 1 {
+		rows = 1
+	}
+	if m.Cursor < m.Offset {
+		m.Offset = m.Cursor
+	}
+	if m.Cursor >= m.Offset+rows {
+		m.Offset = m.Cursor - rows + 1
+	}
+	nameWidth := width - 36
+	if nameWidth < 10 {
+		nameWidth = 10
+	}
+
+	var b strings.Builder
+	b.WriteString("\x1b[H\x1b[2J")
+	fmt.Fprintf(&b, "%d nodes, %d favorites, %d excluded\n", len(m.Nodes), len(m.state().Favorites)-len(m.absent.Favorites), len(m.state().Excluded)-len(m.absent.Excluded))
+	fmt.Fprintf(&b, "     %s %-8s %-6s %8s\n", fit("NAME", nameWidth), "TYPE", "REGION", "LATENCY")
+	for i := m.Offset; i < len(m.Nodes) && i < m.Offset+rows; i++ {
+		n := m.Nodes[i]
+		cursor, mark := " ", " "
+		if i == m.Cursor {
+			cursor = ">"
+		}
+		switch {
+		case n.Favorite:
+			mark = "★"
+		case n.Excluded:
+			mark = "✗"
+		}
+		line := fmt.Sprintf("%s %s   %s %-8s %-6s %8s", cursor, mark, fit(n.Name, nameWidth), n.Type, n.Region, n.latency())
+		if i == m.Cursor {
+			line = "\x1b[7m" + line + "\x1b[0m"
+		}
+		b.WriteString(line + "\n")
+	}
+	if m.Message != "" {
+		b.WriteString(m.Message + "\n")
+	} else {
+		b.WriteString(pickHelp + "\n")
+	}
+	_, _ = io.WriteString(w, b.String())
+}
+
+// readKey reads a key press from a raw terminal, arrow and paging keys
+// are named.
+func readKey(r *bufio.Reader) (string, error) {
+	c, err := r.ReadByte()
+	if err != nil {
+		return "", err
+	}
+	switch c {
+	case 0x03:
+		return "ctrl-c", nil
+	case 0x1b:
+		// the terminal sends an escape sequence in one write, an ESC
+		// with nothing buffered behind it is the escape key
+		if r.Buffered() == 0 {
+			return "esc", nil
+		}
+		if next, _ := r.Peek(1); next[0] != '[' {
+			return "esc", nil
+		}
+		_, _ = r.ReadByte()
+		seq, err := r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		switch seq {
+		case 'A':
+			return "up", nil
+		case 'B':
+			return "down", nil
+		case 'H':
+			return "home", nil
+		case 'F':
+			return "end", nil
+		case '5', '6':
+			_, _ = r.ReadByte() // ~
+			if seq == '5' {
+				return "pgup", nil
+			}
+			return "pgdn", nil
+		}
+		return "esc", nil
+	}
+	return string(rune(c)), nil
+}
+
+func pickMain(args []string) {
+	fs := flag.NewFlagSet("airport2clash pick", flag.ExitOnError)
+	var src sourceFlags
+	src.register(fs)
+	stateFile := fs.String("state", defaultStateFile(), "file keeping favorites and exclusions, read by generate")
+	probeTimeout := fs.Duration("probe-timeout", 3*time.Second, "timeout of the TCP probe of a node")
+	probeConcurrency := fs.Int("probe-concurrency", 16, "nodes probed at once")
+	_ = fs.Parse(args)
+
+	if *stateFile == "" {
+		panic("no -state file")
+	}
+	if !isTerminal(int(os.Stdin.Fd())) {
+		panic("pick needs a terminal")
+	}
+	if err := src.resolve(); err != nil {
+		panic(err)
+	}
+	proxies, err := src.load()
+	if err != nil {
+		panic(err)
+	}
+	state, err := loadPickState(*stateFile)
+	if err != nil {
+		panic(err)
+	}
+	m := newPickModel(newPickNodes(proxies, state), state)
+	_, _ = fmt.Fprintf(os.Stderr, "probing %d nodes...\n", len(m.Nodes))
+	probeAll(m.Nodes, *probeConcurrency, *probeTimeout)
+
+	fd := int(os.Stdin.Fd())
+	old, err := makeRaw(fd)
+	if err != nil {
+		panic(err)
+	}
+	defer func() { _ = restoreTerm(fd, old) }()
+	in := bufio.NewReader(os.Stdin)
+	for {
+		width, height, err := termSize(int(os.Stdout.Fd()))
+		if err != nil || width == 0 || height == 0 {
+			width, height = 80, 24
+		}
+		m.render(os.Stdout, width, height)
+		key, err := readKey(in)
+		if err != nil {
+			panic(err)
+		}
+		switch m.handle(key) {
+		case pickQuit:
+			fmt.Print("\x1b[H\x1b[2J")
+			return
+		case pickSave:
+			if err := m.state().store(*stateFile); err != nil {
+				m.Message = fmt.Sprintf("cannot save: %s", err)
+				continue
+			}
+			m.Dirty = false
+			m.Message = "saved to " + *stateFile
+		case pickProbe:
+			m.Message = "probing..."
+			m.render(os.Stdout, width, height)
+			probeAll(m.Nodes, *probeConcurrency, *probeTimeout)
+			m.Message = ""
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPickModel(t *testing.T) {
+	state := &pickState{Favorites: []string{"gone"}, Excluded: []string{"🇯🇵 日本 01"}}
+	proxies := []map[string]interface{}{
+		{"name": "🇭🇰 香港 01", "type": "ss", "server": "hk.example.net", "port": 443},
+		{"name": "🇯🇵 日本 01", "type": "trojan", "server": "jp.example.net", "port": 443},
+		{"name": "US 01", "type": "vmess", "server": "us.example.net", "port": 443},
+	}
+	m := newPickModel(newPickNodes(proxies, state), state)
+	if m.Nodes[2].Region != "US" || !m.Nodes[1].Excluded {
+		t.Fatalf("unexpected nodes %+v %+v", m.Nodes[1], m.Nodes[2])
+	}
+	m.Nodes[0].Latency = 80 * time.Millisecond
+	m.Nodes[1].ProbeErr = errors.New("timeout")
+	m.Nodes[2].Latency = 20 * time.Millisecond
+
+	for _, key := range []string{"down", "f", "down", "down", "x"} {
+		if action := m.handle(key); action != pickNone {
+			t.Fatalf("%s: unexpected action %v", key, action)
+		}
+	}
+	// favoriting the excluded node cleared the exclusion
+	want := &pickState{Favorites: []string{"gone", "🇯🇵 日本 01"}, Excluded: []string{"US 01"}}
+	if got := m.state(); !reflect.DeepEqual(got, want) {
+		t.Errorf("state = %+v, want %+v", got, want)
+	}
+
+	m.handle("l")
+	var order []string
+	for _, n := range m.Nodes {
+		order = append(order, n.Name)
+	}
+	if want := []string{"US 01", "🇭🇰 香港 01", "🇯🇵 日本 01"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("sorted %q, want %q", order, want)
+	}
+	if m.current().Name != "US 01" {
+		t.Errorf("cursor moved to %q", m.current().Name)
+	}
+
+	if m.handle("q") != pickNone || m.Message == "" {
+		t.Error("quitting with unsaved changes did not ask")
+	}
+	if m.handle("q") != pickQuit {
+		t.Error("second q did not quit")
+	}
+
+	var b strings.Builder
+	m.render(&b, 60, 10)
+	if !strings.Contains(b.String(), "20ms") || !strings.Contains(b.String(), "timeout") {
+		t.Errorf("unexpected screen\n%s", b.String())
+	}
+}
+
+func TestPickStateApply(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "state.json")
+	if err := (&pickState{Favorites: []string{"c"}, Excluded: []string{"b"}}).store(name); err != nil {
+		t.Fatal(err)
+	}
+	state, err := loadPickState(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxies := state.apply([]map[string]interface{}{{"name": "a"}, {"name": "b"}, {"name": "c"}, {"name": "d"}})
+	if got := proxyNames(proxies); !reflect.DeepEqual(got, []string{"c", "a", "d"}) {
+		t.Errorf("apply = %q", got)
+	}
+	if state, err := loadPickState(filepath.Join(t.TempDir(), "missing.json")); err != nil || len(state.Favorites) != 0 {
+		t.Errorf("missing state = %+v, %v", state, err)
+	}
+}
+
+func TestReadKey(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("j\x1b[A\x1b[B\x1b[6~\x03"))
+	var keys []string
+	for {
+		key, err := readKey(r)
+		if err != nil {
+			break
+		}
+		keys = append(keys, key)
+	}
+	if want := []string{"j", "up", "down", "pgdn", "ctrl-c"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("keys = %q, want %q", keys, want)
+	}
+}
+
+func TestReadKeyEsc(t *testing.T) {
+	// a lone ESC must not wait for the next key
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	r := bufio.NewReader(pr)
+	keys := make(chan string)
+	go func() {
+		for {
+			key, err := readKey(r)
+			if err != nil {
+				close(keys)
+				return
+			}
+			keys <- key
+		}
+	}()
+	for _, tt := range []struct{ write, want string }{
+		{"\x1b", "esc"},
+		{"\x1b[A", "up"},
+		{"\x1bq", "esc"},
+	} {
+		if _, err := pw.Write([]byte(tt.write)); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case key := <-keys:
+			if key != tt.want {
+				t.Errorf("%q: key %q, want %q", tt.write, key, tt.want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%q: readKey blocked", tt.write)
+		}
+	}
+	// the byte after an ESC that starts no sequence is a key of its own
+	select {
+	case key := <-keys:
+		if key != "q" {
+			t.Errorf("key %q, want q", key)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the q after ESC was lost")
+	}
+}
+
+func TestFit(t *testing.T) {
+	if got := fit("香港 01", 10); got != "香港 01   " {
+		t.Errorf("fit pads to %q", got)
+	}
+	if got := fit("🇭🇰 香港 IPLC 专线", 10); displayWidth(got) != 10 || !strings.HasSuffix(strings.TrimSpace(got), "…") {
+		t.Errorf("fit truncates to %q", got)
+	}
+}
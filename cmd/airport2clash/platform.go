@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+var platforms = []string{"linux", "macos", "windows", "router"}
+
+// fakeIPFilter keeps names that must resolve to real addresses out of
+// the fake-ip pool.
+var fakeIPFilter = []string{
+	"*.lan",
+	"*.local",
+	"+.msftconnecttest.com",
+	"+.msftncsi.com",
+	"time.*.com",
+	"ntp.*.com",
+	"+.stun.*.*",
+	"+.stun.*.*.*",
+	"localhost.ptlogin2.qq.com",
+}
+
+// platformOverlay returns the tun and DNS settings of a client flavor
+// running on a platform, to be merged over the template.
+func platformOverlay(dialect, platform string) (map[string]interface{}, error) {
+	if !contains(dialects, dialect) {
+		return nil, fmt.Errorf("unknown dialect %q, expected one of %v", dialect, dialects)
+	}
+	if !contains(platforms, platform) {
+		return nil, fmt.Errorf("unknown platform %q, expected one of %v", platform, platforms)
+	}
+	var tun map[string]interface{}
+	enhancedMode := "fake-ip"
+	overlay := map[string]interface{}{}
+
+	switch dialect {
+	case "premium":
+		tun = map[string]interface{}{
+			"enable":                true,
+			"stack":                 "system",
+			"dns-hijack":            []string{"any:53"},
+			"auto-route":            true,
+			"auto-detect-interface": true,
+		}
+		switch platform {
+		case "linux":
+			// redir-host keeps real addresses for local tools
+			enhancedMode = "redir-host"
+		case "windows":
+			tun["stack"] = "gvisor"
+		case "router":
+			tun = nil
+		}
+	case "meta":
+		tun = map[string]interface{}{
+			"enable":                true,
+			"stack":                 "mixed",
+			"dns-hijack":            []string{"any:53", "tcp://any:53"},
+			"auto-route":            true,
+			"auto-detect-interface": true,
+		}
+		switch platform {
+		case "linux":
+			tun["device"] = "clash0"
+			tun["auto-redirect"] = true
+		case "windows":
+			tun["stack"] = "gvisor"
+			tun["strict-route"] = true
+		case "router":
+			tun["stack"] = "system"
+			tun["auto-redirect"] = true
+		}
+	case "clashx":
+		// ClashX manages its own enhanced mode, the tun section is
+		// not understood
+		if platform != "macos" {
+			return nil, fmt.Errorf("dialect clashx only runs on macos")
+		}
+	}
+
+	if platform == "router" {
+		overlay["allow-lan"] = true
+		overlay["bind-address"] = "*"
+		overlay["redir-port"] = 7892
+		overlay["tproxy-port"] = 7893
+	}
+	if tun == nil {
+		tun = map[string]interface{}{"enable": false}
+	}
+	if dialect == "clashx" {
+		overlay["tun"] = nil
+	} else {
+		overlay["tun"] = tun
+	}
+
+	dns := map[string]interface{}{
+		"enhanced-mode": enhancedMode,
+	}
+	if enhancedMode == "fake-ip" {
+		dns["fake-ip-filter"] = fakeIPFilter
+	}
+	if platform == "router" {
+		dns["listen"] = "0.0.0.0:1053"
+	}
+	overlay["dns"] = dns
+	return overlay, nil
+}
+
+// applyPlatform replaces the tun section of settings and adjusts the
+// DNS settings for the client flavor and platform.
+func applyPlatform(settings *yaml.Node, dialect, platform string) error {
+	overlay, err := platformOverlay(dialect, platform)
+	if err != nil {
+		return err
+	}
+	if tun := overlay["tun"]; tun != nil {
+		// replace rather than merge, the template tun settings only
+		// make sense for Linux
+		node := &yaml.Node{}
+		if err := node.Encode(tun); err != nil {
+			return err
+		}
+		if idx := mappingIndex(settings, "tun"); idx != -1 {
+			settings.Content[idx+1] = node
+		} else {
+			settings.Content = append(settings.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "tun"}, node)
+		}
+		delete(overlay, "tun")
+	}
+	return mergeOverlay(settings, overlay)
+}
+
+// mergeOverlay encodes v and merges it into settings.
+func mergeOverlay(settings *yaml.Node, v interface{}) error {
+	node := &yaml.Node{}
+	if err := node.Encode(v); err != nil {
+		return err
+	}
+	mergeNode(settings, node)
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+// checkGolden compares got with testdata/name, or rewrites it with
+// -update.
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("%s mismatch, run go test -update\n--- got\n%s\n--- want\n%s", path, got, want)
+	}
+}
+
+func TestApplyPlatform(t *testing.T) {
+	for _, dialect := range dialects {
+		for _, platform := range platforms {
+			name := dialect + "-" + platform
+			t.Run(name, func(t *testing.T) {
+				settings := defaultSettings()
+				err := applyPlatform(settings, dialect, platform)
+				if dialect == "clashx" && platform != "macos" {
+					if err == nil {
+						t.Fatal("expected an error")
+					}
+					return
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				checkGolden(t, filepath.Join("platform", name+".yaml"), []byte(renderSettings(settings)))
+			})
+		}
+	}
+}
+
+func TestApplyPlatformUnknown(t *testing.T) {
+	if err := applyPlatform(defaultSettings(), "premium", "plan9"); err == nil {
+		t.Error("expected an error for an unknown platform")
+	}
+	if err := applyPlatform(defaultSettings(), "surge", "linux"); err == nil {
+		t.Error("expected an error for an unknown dialect")
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// profile is a YAML overlay for a machine. Its keys are merged into the
+// settings of the generated config, except prepend-rules and
+// append-rules which are added around the template rules, e.g.
+//
+//	mixed-port: 7891
+//	dns:
+//	  nameserver-policy:
+//	    '+.corp.example.com': 10.0.0.53
+//	prepend-rules:
+//	  - DOMAIN-SUFFIX,corp.example.com,DIRECT
+type profile struct {
+	Name         string
+	Settings     *yaml.Node
+	PrependRules []string
+	AppendRules  []string
+}
+
+func defaultProfileDir() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "airport2clash", "profiles")
+}
+
+// profilePath maps a profile name to dir/<name>.yaml, anything that
+// looks like a path is used as is.
+func profilePath(name, dir string) string {
+	if strings.ContainsRune(name, filepath.Separator) || strings.HasSuffix(name, ".yaml") || strings.HasSuffix(name, ".yml") {
+		return name
+	}
+	return filepath.Join(dir, name+".yaml")
+}
+
+func loadProfile(name, dir string) (*profile, error) {
+	path := profilePath(name, dir)
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("profile %s: %w", name, err)
+	}
+	doc := &yaml.Node{}
+	if err := yaml.Unmarshal(b, doc); err != nil {
+		return nil, fmt.Errorf("profile %s: %w", path, err)
+	}
+	p := &profile{Name: name, Settings: &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}}
+	if len(doc.Content) == 0 {
+		return p, nil
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("profile %s: expected a mapping", path)
+	}
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		key, value := root.Content[i], root.Content[i+1]
+		switch key.Value {
+		case "prepend-rules":
+			err = value.Decode(&p.PrependRules)
+		case "append-rules":
+			err = value.Decode(&p.AppendRules)
+		case "proxies", "proxy-groups", "rules":
+			err = fmt.Errorf("%s is generated, use prepend-rules or append-rules", key.Value)
+		default:
+			p.Settings.Content = append(p.Settings.Content, key, value)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("profile %s: %s: %w", path, key.Value, err)
+		}
+	}
+	for _, s := range append(p.PrependRules, p.AppendRules...) {
+		if _, err := parseRule(s); err != nil {
+			return nil, fmt.Errorf("profile %s: %w", path, err)
+		}
+	}
+	return p, nil
+}
+
+// apply merges the profile into settings and returns rules with the
+// profile rules added, appended rules go before a trailing MATCH.
+func (p *profile) apply(settings *yaml.Node, rules []string) []string {
+	mergeNode(settings, p.Settings)
+	result := make([]string, 0, len(p.PrependRules)+len(rules)+len(p.AppendRules))
+	result = append(result, p.PrependRules...)
+	tail := len(rules)
+	if tail > 0 {
+		if r, err := parseRule(rules[tail-1]); err == nil && r.Type == "MATCH" {
+			tail--
+		}
+	}
+	result = append(result, rules[:tail]...)
+	result = append(result, p.AppendRules...)
+	return append(result, rules[tail:]...)
+}
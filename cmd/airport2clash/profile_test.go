@@ -0,0 +1,145 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func writeProfile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadProfile(t *testing.T) {
+	dir := t.TempDir()
+	writeProfile(t, dir, "work.yaml", `mixed-port: 7891
+prepend-rules:
+  - 'DOMAIN-SUFFIX,corp.example.com,DIRECT'
+append-rules:
+  - 'IP-CIDR,10.0.0.0/8,DIRECT,no-resolve'
+`)
+	writeProfile(t, dir, "empty.yaml", "")
+	writeProfile(t, dir, "list.yaml", "- a\n")
+	writeProfile(t, dir, "rules.yaml", "rules:\n  - 'MATCH,DIRECT'\n")
+	writeProfile(t, dir, "bad.yaml", "prepend-rules:\n  - 'DOMAIN-SUFIX,a.com,DIRECT'\n")
+
+	p, err := loadProfile("work", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(p.PrependRules, []string{"DOMAIN-SUFFIX,corp.example.com,DIRECT"}) ||
+		!reflect.DeepEqual(p.AppendRules, []string{"IP-CIDR,10.0.0.0/8,DIRECT,no-resolve"}) {
+		t.Errorf("rules %q and %q", p.PrependRules, p.AppendRules)
+	}
+	if len(p.Settings.Content) != 2 || p.Settings.Content[0].Value != "mixed-port" {
+		t.Errorf("settings %v, want only mixed-port", p.Settings.Content)
+	}
+
+	// a path is used as is
+	if p, err := loadProfile(filepath.Join(dir, "empty.yaml"), "/nonexistent"); err != nil || len(p.Settings.Content) != 0 {
+		t.Errorf("empty profile: %v, %v", p, err)
+	}
+
+	for name, want := range map[string]string{
+		"missing": "no such file",
+		"list":    "expected a mapping",
+		"rules":   "rules is generated",
+		"bad":     "unknown rule type",
+	} {
+		if _, err := loadProfile(name, dir); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("loadProfile(%q) error %v, want %q", name, err, want)
+		}
+	}
+}
+
+func TestProfileApply(t *testing.T) {
+	p := &profile{
+		Settings:     &yaml.Node{Kind: yaml.MappingNode},
+		PrependRules: []string{"DOMAIN,first.example.com,DIRECT"},
+		AppendRules:  []string{"DOMAIN,last.example.com,DIRECT"},
+	}
+	tests := []struct {
+		rules []string
+		want  []string
+	}{
+		{
+			rules: []string{"DOMAIN-SUFFIX,google.com,Proxy", "MATCH,Proxy"},
+			want:  []string{"DOMAIN,first.example.com,DIRECT", "DOMAIN-SUFFIX,google.com,Proxy", "DOMAIN,last.example.com,DIRECT", "MATCH,Proxy"},
+		},
+		{
+			rules: []string{"DOMAIN-SUFFIX,google.com,Proxy", "FINAL,Proxy"},
+			want:  []string{"DOMAIN,first.example.com,DIRECT", "DOMAIN-SUFFIX,google.com,Proxy", "DOMAIN,last.example.com,DIRECT", "FINAL,Proxy"},
+		},
+		{
+			rules: []string{"DOMAIN-SUFFIX,google.com,Proxy"},
+			want:  []string{"DOMAIN,first.example.com,DIRECT", "DOMAIN-SUFFIX,google.com,Proxy", "DOMAIN,last.example.com,DIRECT"},
+		},
+		{
+			want: []string{"DOMAIN,first.example.com,DIRECT", "DOMAIN,last.example.com,DIRECT"},
+		},
+	}
+	for _, tt := range tests {
+		if got := p.apply(&yaml.Node{Kind: yaml.MappingNode}, tt.rules); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("apply(%q) = %q, want %q", tt.rules, got, tt.want)
+		}
+	}
+}
+
+func TestMergeNode(t *testing.T) {
+	var dst, src yaml.Node
+	if err := yaml.Unmarshal([]byte(`mixed-port: 7890
+allow-lan: true
+tun:
+  enable: true
+dns:
+  enable: true
+  nameserver: [223.5.5.5]
+  nameserver-policy:
+    '+.corp.example.com': 10.0.0.53
+`), &dst); err != nil {
+		t.Fatal(err)
+	}
+	if err := yaml.Unmarshal([]byte(`mixed-port: 7891
+tun: null
+dns:
+  nameserver: [1.1.1.1]
+  nameserver-policy: ~
+  ipv6: false
+external-controller: 127.0.0.1:9090
+`), &src); err != nil {
+		t.Fatal(err)
+	}
+	mergeNode(dst.Content[0], src.Content[0])
+	var got, want map[string]interface{}
+	if err := dst.Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if err := yaml.Unmarshal([]byte(`mixed-port: 7891
+allow-lan: true
+dns:
+  enable: true
+  nameserver: [1.1.1.1]
+  ipv6: false
+external-controller: 127.0.0.1:9090
+`), &want); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("merged %v, want %v", got, want)
+	}
+	// keys keep their order, new ones go last
+	var keys []string
+	for i := 0; i < len(dst.Content[0].Content); i += 2 {
+		keys = append(keys, dst.Content[0].Content[i].Value)
+	}
+	if want := []string{"mixed-port", "allow-lan", "dns", "external-controller"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("keys %q, want %q", keys, want)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// providerOptions configures the proxy-providers output mode, in which
+// the config references the nodes instead of inlining them.
+type providerOptions struct {
+	Enabled        bool
+	Name           string
+	URL            string
+	File           string
+	Interval       int
+	HealthCheckURL string
+	HealthInterval int
+	Filter         string
+	ExcludeFilter  string
+}
+
+// provider returns the proxy-providers entry. Clash fetches URL if set,
+// otherwise reads File; only mihomo can consume the raw subscription,
+// which is used as a last resort. That puts the subscription token in
+// the config, and is refused when rewrites, the local changes made to
+// the nodes, would be lost.
+func (o providerOptions) provider(source, dialect string, rewrites []string) (map[string]interface{}, error) {
+	p := map[string]interface{}{
+		"health-check": map[string]interface{}{
+			"enable":   true,
+			"url":      o.HealthCheckURL,
+			"interval": o.HealthInterval,
+		},
+	}
+	switch {
+	case o.URL != "":
+		p["type"] = "http"
+		p["url"] = o.URL
+		p["interval"] = o.Interval
+		p["path"] = "./providers/" + o.Name + ".yaml"
+	case o.File != "":
+		path, err := filepath.Abs(o.File)
+		if err != nil {
+			return nil, err
+		}
+		p["type"] = "file"
+		p["path"] = path
+	case dialect == "meta":
+		if len(rewrites) > 0 {
+			return nil, fmt.Errorf("the raw subscription as provider loses %s, use -provider-file", strings.Join(rewrites, ", "))
+		}
+		p["type"] = "http"
+		p["url"] = source
+		p["interval"] = o.Interval
+		p["path"] = "./providers/" + o.Name + ".yaml"
+	default:
+		return nil, fmt.Errorf("dialect %s cannot read subscriptions, use -provider-file or -provider-url", dialect)
+	}
+	if o.Filter != "" {
+		p["filter"] = o.Filter
+	}
+	if o.ExcludeFilter != "" {
+		p["exclude-filter"] = o.ExcludeFilter
+	}
+	return p, nil
+}
+
+// writeProviderFile writes the converted proxies as a provider file.
+func writeProviderFile(name string, proxies []map[string]interface{}) error {
+	return os.WriteFile(name, []byte("proxies:\n"+renderProxies(proxies)), 0644)
+}
+
+// useProvider makes group take the nodes from the provider rather than
+// listing them.
+func useProvider(group map[string]interface{}, provider string, proxies []map[string]interface{}) {
+	nodes := make(map[string]bool, len(proxies))
+	for _, proxy := range proxies {
+		nodes[proxy["name"].(string)] = true
+	}
+	var names []string
+	for _, name := range group["proxies"].([]string) {
+		if !nodes[name] {
+			names = append(names, name)
+		}
+	}
+	if len(names) > 0 {
+		group["proxies"] = names
+	} else {
+		delete(group, "proxies")
+	}
+	group["use"] = []string{provider}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func providerTestOptions() providerOptions {
+	return providerOptions{
+		Enabled:        true,
+		Name:           "airport",
+		Interval:       86400,
+		HealthCheckURL: "http://www.gstatic.com/generate_204",
+		HealthInterval: 600,
+	}
+}
+
+func providerTestProxies() []map[string]interface{} {
+	return []map[string]interface{}{
+		{"name": "🇭🇰 香港 01", "type": "trojan", "server": "hk1.example.net", "port": 443, "password": "pw"},
+		{"name": "🇯🇵 日本 01", "type": "ss", "server": "jp1.example.net", "port": 8388, "cipher": "aes-256-gcm", "password": "pw"},
+	}
+}
+
+// TestProviderBlock renders the proxy-providers settings and the groups
+// using them the way main does.
+func TestProviderBlock(t *testing.T) {
+	tests := []struct {
+		name    string
+		dialect string
+		opts    func(*providerOptions)
+	}{
+		{name: "url", dialect: "premium", opts: func(o *providerOptions) { o.URL = "https://example.com/provider.yaml" }},
+		{name: "meta", dialect: "meta", opts: func(o *providerOptions) { o.Filter = "香港|日本"; o.ExcludeFilter = "过期" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := providerTestOptions()
+			tt.opts(&opts)
+			provider, err := opts.provider("https://sub.example.com/api?token=x", tt.dialect, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			settings := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			if err := mergeOverlay(settings, map[string]interface{}{
+				"proxy-providers": map[string]interface{}{opts.Name: provider},
+			}); err != nil {
+				t.Fatal(err)
+			}
+			proxies := providerTestProxies()
+			groups := []map[string]interface{}{proxyGroupAirport(proxies), proxyGroupAutoSelect(proxies), proxyGroupFallback(proxies)}
+			for _, group := range groups {
+				useProvider(group, opts.Name, proxies)
+			}
+			got := renderSettings(settings) + "proxy-groups:\n" + renderProxies(groups)
+			checkGolden(t, filepath.Join("provider", tt.name+".yaml"), []byte(got))
+		})
+	}
+}
+
+func TestProviderFile(t *testing.T) {
+	opts := providerTestOptions()
+	opts.File = filepath.Join(t.TempDir(), "airport.yaml")
+	provider, err := opts.provider("https://sub.example.com/api?token=x", "premium", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if provider["type"] != "file" || provider["path"] != opts.File || provider["url"] != nil {
+		t.Errorf("provider %v", provider)
+	}
+	if err := writeProviderFile(opts.File, providerTestProxies()); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(opts.File)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, filepath.Join("provider", "file.yaml"), b)
+	var file clashConfig
+	if err := yaml.Unmarshal(b, &file); err != nil || len(file.Proxies) != 2 {
+		t.Errorf("provider file has %d proxies, %v", len(file.Proxies), err)
+	}
+
+	// a relative file is made absolute, Clash runs from its own directory
+	opts.File = "airport.yaml"
+	provider, err = opts.provider("", "premium", nil)
+	if err != nil || !filepath.IsAbs(provider["path"].(string)) {
+		t.Errorf("provider %v, %v", provider, err)
+	}
+
+	opts.File = ""
+	if _, err := opts.provider("https://sub.example.com/api", "premium", nil); err == nil || !strings.Contains(err.Error(), "-provider-file") {
+		t.Errorf("error %v, want a hint at -provider-file", err)
+	}
+}
+
+func TestProviderRewrites(t *testing.T) {
+	opts := providerTestOptions()
+	rewrites := []string{"-rename-flags", "-chain"}
+	_, err := opts.provider("https://sub.example.com/api?token=x", "meta", rewrites)
+	if err == nil || !strings.Contains(err.Error(), "-rename-flags, -chain") || !strings.Contains(err.Error(), "-provider-file") {
+		t.Errorf("error %v, want the rewrites and a hint at -provider-file", err)
+	}
+
+	// nodes Clash does not fetch itself keep the changes
+	opts.File = filepath.Join(t.TempDir(), "airport.yaml")
+	if _, err := opts.provider("https://sub.example.com/api?token=x", "meta", rewrites); err != nil {
+		t.Error(err)
+	}
+	opts.File, opts.URL = "", "https://example.com/provider.yaml"
+	if _, err := opts.provider("https://sub.example.com/api?token=x", "meta", rewrites); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestUseProvider(t *testing.T) {
+	proxies := providerTestProxies()
+	group := map[string]interface{}{"name": "翻墙机场", "type": "select", "proxies": []string{"自动选择", "🇭🇰 香港 01", "DIRECT", "🇯🇵 日本 01"}}
+	useProvider(group, "airport", proxies)
+	if want := []string{"自动选择", "DIRECT"}; !reflect.DeepEqual(group["proxies"], want) {
+		t.Errorf("proxies %q, want %q", group["proxies"], want)
+	}
+	if !reflect.DeepEqual(group["use"], []string{"airport"}) {
+		t.Errorf("use %q", group["use"])
+	}
+	group = proxyGroupAutoSelect(proxies)
+	useProvider(group, "airport", proxies)
+	if _, ok := group["proxies"]; ok {
+		t.Errorf("proxies %q left in a group of nodes only", group["proxies"])
+	}
+}
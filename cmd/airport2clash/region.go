@@ -0,0 +1,370 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// region is a country or area nodes are grouped by. Keywords are
+// matched case insensitively, ASCII ones as whole words.
+type region struct {
+	Code     string // ISO 3166-1 alpha-2
+	Name     string
+	Keywords []string
+}
+
+var regions = []region{
+	{"HK", "香港", []string{"香港", "hong kong", "hongkong", "hk"}},
+	{"TW", "台湾", []string{"台湾", "台灣", "taiwan", "tw"}},
+	{"MO", "澳门", []string{"澳门", "澳門", "macau", "macao"}},
+	{"JP", "日本", []string{"日本", "东京", "大阪", "japan", "tokyo", "osaka", "jp"}},
+	{"KR", "韩国", []string{"韩国", "韓國", "首尔", "korea", "seoul", "kr"}},
+	{"SG", "新加坡", []string{"新加坡", "狮城", "singapore", "sg"}},
+	{"US", "美国", []string{"美国", "美國", "洛杉矶", "硅谷", "united states", "los angeles", "san jose", "usa", "us"}},
+	{"CA", "加拿大", []string{"加拿大", "canada", "ca"}},
+	{"GB", "英国", []string{"英国", "英國", "伦敦", "united kingdom", "london", "uk"}},
+	{"DE", "德国", []string{"德国", "德國", "法兰克福", "germany", "frankfurt", "de"}},
+	{"FR", "法国", []string{"法国", "法國", "巴黎", "france", "paris", "fr"}},
+	{"NL", "荷兰", []string{"荷兰", "荷蘭", "netherlands", "amsterdam", "nl"}},
+	{"RU", "俄罗斯", []string{"俄罗斯", "俄羅斯", "russia", "moscow", "ru"}},
+	{"IN", "印度", []string{"印度", "india"}},
+	{"AU", "澳大利亚", []string{"澳大利亚", "澳洲", "australia", "sydney", "au"}},
+	{"TR", "土耳其", []string{"土耳其", "turkey", "tr"}},
+	{"AR", "阿根廷", []string{"阿根廷", "argentina", "ar"}},
+	{"MY", "马来西亚", []string{"马来西亚", "malaysia"}},
+	{"TH", "泰国", []string{"泰国", "thailand", "th"}},
+	{"VN", "越南", []string{"越南", "vietnam", "vn"}},
+	{"PH", "菲律宾", []string{"菲律宾", "philippines", "ph"}},
+}
+
+func regionByCode(code string) (region, bool) {
+	for _, r := range regions {
+		if r.Code == code {
+			return r, true
+		}
+	}
+	return region{}, false
+}
+
+// flagEmoji returns the flag of an ISO 3166-1 alpha-2 code.
+func flagEmoji(code string) string {
+	if len(code) != 2 {
+		return ""
+	}
+	var b strings.Builder
+	for _, c := range strings.ToUpper(code) {
+		if c < 'A' || c > 'Z' {
+			return ""
+		}
+		b.WriteRune(0x1F1E6 + c - 'A')
+	}
+	return b.String()
+}
+
+func isRegionalIndicator(r rune) bool {
+	return r >= 0x1F1E6 && r <= 0x1F1FF
+}
+
+// flagCode returns the code of the first flag emoji in s.
+func flagCode(s string) string {
+	runes := []rune(s)
+	for i := 0; i+1 < len(runes); i++ {
+		if isRegionalIndicator(runes[i]) && isRegionalIndicator(runes[i+1]) {
+			return string([]rune{'A' + runes[i] - 0x1F1E6, 'A' + runes[i+1] - 0x1F1E6})
+		}
+	}
+	return ""
+}
+
+// regionOfName detects the region of a node from its name, by flag
+// emoji first and then by keywords. It returns "" if the name has none.
+func regionOfName(name string) string {
+	if code := flagCode(name); code != "" {
+		return code
+	}
+	lower := strings.ToLower(name)
+	words := strings.FieldsFunc(lower, func(r rune) bool {
+		return r > unicode.MaxASCII || !unicode.IsLetter(r)
+	})
+	for _, r := range regions {
+		for _, keyword := range r.Keywords {
+			if keyword[0] > unicode.MaxASCII {
+				if strings.Contains(lower, keyword) {
+					return r.Code
+				}
+				continue
+			}
+			if strings.Contains(keyword, " ") {
+				if strings.Contains(lower, keyword) {
+					return r.Code
+				}
+				continue
+			}
+			for _, w := range words {
+				if w == keyword {
+					return r.Code
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// countryLookup maps an address to its country, geoIP implements it.
+type countryLookup interface {
+	Country(ip netip.Addr) string
+}
+
+// newLookup returns a host lookup using the DNS server at addr, or the
+// system resolver if addr is empty.
+func newLookup(addr string) func(ctx context.Context, host string) ([]netip.Addr, error) {
+	resolver := net.DefaultResolver
+	if addr != "" {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			addr = net.JoinHostPort(addr, "53")
+		}
+		resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, addr)
+			},
+		}
+	}
+	return func(ctx context.Context, host string) ([]netip.Addr, error) {
+		return resolver.LookupNetIP(ctx, "ip", host)
+	}
+}
+
+// regionCache remembers the country of resolved servers in a JSON file,
+// a zero Path keeps it in memory.
+type regionCache struct {
+	Path string
+	TTL  time.Duration
+
+	mu      sync.Mutex
+	entries map[string]regionCacheEntry
+}
+
+type regionCacheEntry struct {
+	Country    string    `json:"country"`
+	ResolvedAt time.Time `json:"resolved_at"`
+}
+
+func (c *regionCache) load() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = map[string]regionCacheEntry{}
+	if c.Path == "" {
+		return nil
+	}
+	b, err := os.ReadFile(c.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(b, &c.entries); err != nil {
+		return fmt.Errorf("corrupted cache %s: %w", c.Path, err)
+	}
+	return nil
+}
+
+func (c *regionCache) get(server string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[server]
+	if !ok || c.TTL > 0 && time.Since(e.ResolvedAt) > c.TTL {
+		return "", false
+	}
+	return e.Country, true
+}
+
+func (c *regionCache) put(server, country string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = map[string]regionCacheEntry{}
+	}
+	c.entries[server] = regionCacheEntry{Country: country, ResolvedAt: time.Now()}
+}
+
+func (c *regionCache) store() error {
+	if c.Path == "" {
+		return nil
+	}
+	c.mu.Lock()
+	b, err := json.MarshalIndent(c.entries, "", "  ")
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.Path), 0700); err != nil {
+		return err
+	}
+	return writeFileAtomic(c.Path, b, 0600)
+}
+
+// regionDetector finds the region of nodes whose names have none by
+// looking up the country of their server.
+type regionDetector struct {
+	Lookup      func(ctx context.Context, host string) ([]netip.Addr, error)
+	GeoIP       countryLookup
+	Cache       *regionCache
+	Concurrency int
+	Timeout     time.Duration
+}
+
+// detect returns the region code of every proxy, "" when unknown.
+func (d *regionDetector) detect(proxies []map[string]interface{}) []string {
+	codes := make([]string, len(proxies))
+	var servers []string
+	seen := map[string]bool{}
+	for i, proxy := range proxies {
+		name, _ := proxy["name"].(string)
+		if codes[i] = regionOfName(name); codes[i] != "" {
+			continue
+		}
+		server, _ := proxy["server"].(string)
+		if server != "" && !seen[server] {
+			seen[server] = true
+			servers = append(servers, server)
+		}
+	}
+	if len(servers) == 0 || d.GeoIP == nil {
+		return codes
+	}
+	if d.Cache == nil {
+		d.Cache = &regionCache{}
+	}
+
+	concurrency := d.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for _, server := range servers {
+		if _, ok := d.Cache.get(server); ok {
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(server string) {
+			defer func() { <-sem; wg.Done() }()
+			country, err := d.country(server)
+			if err != nil {
+				log.Printf("warning: region of %s: %s", server, err)
+				return
+			}
+			d.Cache.put(server, country)
+		}(server)
+	}
+	wg.Wait()
+
+	for i, proxy := range proxies {
+		if codes[i] != "" {
+			continue
+		}
+		server, _ := proxy["server"].(string)
+		if country, ok := d.Cache.get(server); ok && country != "LAN" {
+			codes[i] = country
+		}
+	}
+	return codes
+}
+
+func (d *regionDetector) country(server string) (string, error) {
+	if ip, err := netip.ParseAddr(server); err == nil {
+		return d.GeoIP.Country(ip.Unmap()), nil
+	}
+	ctx := context.Background()
+	if d.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.Timeout)
+		defer cancel()
+	}
+	lookup := d.Lookup
+	if lookup == nil {
+		lookup = newLookup("")
+	}
+	ips, err := lookup(ctx, server)
+	if err != nil {
+		return "", err
+	}
+	for _, ip := range ips {
+		if country := d.GeoIP.Country(ip.Unmap()); country != "" {
+			return country, nil
+		}
+	}
+	return "", nil
+}
+
+// renameWithFlags prefixes the flag of their region to names without
+// one.
+func renameWithFlags(proxies []map[string]interface{}, codes []string) {
+	for i, proxy := range proxies {
+		name, _ := proxy["name"].(string)
+		if flag := flagEmoji(codes[i]); flag != "" && flagCode(name) == "" {
+			proxy["name"] = flag + " " + name
+		}
+	}
+}
+
+func regionGroupName(code string) string {
+	name := code
+	if r, ok := regionByCode(code); ok {
+		name = r.Name
+	}
+	return flagEmoji(code) + " " + name
+}
+
+// regionGroups returns a url-test group per region, known regions in
+// the order of regions and the others by code.
+func regionGroups(proxies []map[string]interface{}, codes []string) []map[string]interface{} {
+	members := map[string][]string{}
+	for i, proxy := range proxies {
+		if codes[i] != "" {
+			members[codes[i]] = append(members[codes[i]], proxy["name"].(string))
+		}
+	}
+	order := make([]string, 0, len(members))
+	for _, r := range regions {
+		if members[r.Code] != nil {
+			order = append(order, r.Code)
+		}
+	}
+	var others []string
+	for code := range members {
+		if _, ok := regionByCode(code); !ok {
+			others = append(others, code)
+		}
+	}
+	sort.Strings(others)
+	order = append(order, others...)
+
+	groups := make([]map[string]interface{}, 0, len(order))
+	for _, code := range order {
+		m := make(map[string]interface{})
+		m["name"] = regionGroupName(code)
+		m["type"] = "url-test"
+		m["proxies"] = members[code]
+		m["url"] = "http://www.gstatic.com/generate_204"
+		m["interval"] = 86400
+		groups = append(groups, m)
+	}
+	return groups
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRegionOfName(t *testing.T) {
+	tests := map[string]string{
+		"🇭🇰 香港 01":           "HK",
+		"香港 IPLC 02":         "HK",
+		"HK-BGP-01":          "HK",
+		"Japan Tokyo 1":      "JP",
+		"🇺🇸 Los Angeles":     "US",
+		"US 01 | 1.5x":       "US",
+		"美国 硅谷":              "US",
+		"Hong Kong 02":       "HK",
+		"剩余流量：120.5 GB":      "",
+		"Bonus node":         "",
+		"Expire: 2026-12-31": "",
+	}
+	for name, want := range tests {
+		if got := regionOfName(name); got != want {
+			t.Errorf("regionOfName(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestFlagEmoji(t *testing.T) {
+	if got := flagEmoji("jp"); got != "🇯🇵" {
+		t.Errorf("flagEmoji(jp) = %q", got)
+	}
+	if got := flagCode("节点 🇸🇬 02"); got != "SG" {
+		t.Errorf("flagCode = %q", got)
+	}
+	if flagEmoji("LAN") != "" || flagCode("HK 01") != "" {
+		t.Error("expected no flag")
+	}
+}
+
+type stubGeoIP map[netip.Addr]string
+
+func (g stubGeoIP) Country(ip netip.Addr) string { return g[ip] }
+
+// stubResolver answers from a table and records the peak concurrency.
+type stubResolver struct {
+	hosts map[string]string
+
+	mu      sync.Mutex
+	calls   map[string]int
+	running int32
+	peak    int32
+}
+
+func (r *stubResolver) lookup(ctx context.Context, host string) ([]netip.Addr, error) {
+	n := atomic.AddInt32(&r.running, 1)
+	defer atomic.AddInt32(&r.running, -1)
+	r.mu.Lock()
+	r.calls[host]++
+	if n > r.peak {
+		r.peak = n
+	}
+	r.mu.Unlock()
+	time.Sleep(10 * time.Millisecond)
+	ip, ok := r.hosts[host]
+	if !ok {
+		return nil, errors.New("no such host")
+	}
+	return []netip.Addr{netip.MustParseAddr(ip)}, nil
+}
+
+func TestRegionDetector(t *testing.T) {
+	resolver := &stubResolver{
+		hosts: map[string]string{
+			"a.example.net": "192.0.2.1",
+			"b.example.net": "198.51.100.1",
+			"c.example.net": "203.0.113.1",
+			"d.example.net": "10.0.0.1",
+		},
+		calls: map[string]int{},
+	}
+	geo := stubGeoIP{
+		netip.MustParseAddr("192.0.2.1"):    "JP",
+		netip.MustParseAddr("198.51.100.1"): "DE",
+		netip.MustParseAddr("203.0.113.1"):  "BR",
+		netip.MustParseAddr("2001:db8::1"):  "SG",
+		netip.MustParseAddr("10.0.0.1"):     "LAN",
+	}
+	proxies := []map[string]interface{}{
+		{"name": "🇭🇰 香港 01", "server": "a.example.net"},
+		{"name": "node 1", "server": "a.example.net"},
+		{"name": "node 2", "server": "a.example.net"},
+		{"name": "node 3", "server": "b.example.net"},
+		{"name": "node 4", "server": "c.example.net"},
+		{"name": "node 5", "server": "2001:db8::1"},
+		{"name": "node 6", "server": "d.example.net"},
+		{"name": "node 7", "server": "unknown.example.net"},
+	}
+	cache := &regionCache{Path: filepath.Join(t.TempDir(), "regions.json"), TTL: time.Hour}
+	if err := cache.load(); err != nil {
+		t.Fatal(err)
+	}
+	d := &regionDetector{Lookup: resolver.lookup, GeoIP: geo, Cache: cache, Concurrency: 2}
+	codes := d.detect(proxies)
+	want := []string{"HK", "JP", "JP", "DE", "BR", "SG", "", ""}
+	if !reflect.DeepEqual(codes, want) {
+		t.Fatalf("detect = %q, want %q", codes, want)
+	}
+	if resolver.calls["a.example.net"] != 1 {
+		t.Errorf("a.example.net resolved %d times", resolver.calls["a.example.net"])
+	}
+	if resolver.peak > 2 {
+		t.Errorf("%d lookups at once, want at most 2", resolver.peak)
+	}
+
+	// a second run is answered from the cache file
+	if err := cache.store(); err != nil {
+		t.Fatal(err)
+	}
+	cache = &regionCache{Path: cache.Path, TTL: time.Hour}
+	if err := cache.load(); err != nil {
+		t.Fatal(err)
+	}
+	resolver.calls = map[string]int{}
+	d = &regionDetector{Lookup: resolver.lookup, GeoIP: geo, Cache: cache, Concurrency: 2}
+	if codes := d.detect(proxies); !reflect.DeepEqual(codes, want) {
+		t.Fatalf("cached detect = %q, want %q", codes, want)
+	}
+	if !reflect.DeepEqual(resolver.calls, map[string]int{"unknown.example.net": 1}) {
+		t.Errorf("unexpected lookups %v", resolver.calls)
+	}
+}
+
+func TestRegionGroups(t *testing.T) {
+	proxies := []map[string]interface{}{
+		{"name": "node 1"},
+		{"name": "🇭🇰 香港 01"},
+		{"name": "node 2"},
+		{"name": "node 3"},
+		{"name": "info"},
+	}
+	codes := []string{"BR", "HK", "JP", "HK", ""}
+	renameWithFlags(proxies, codes)
+	var names []string
+	for _, proxy := range proxies {
+		names = append(names, proxy["name"].(string))
+	}
+	if want := []string{"🇧🇷 node 1", "🇭🇰 香港 01", "🇯🇵 node 2", "🇭🇰 node 3", "info"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("renamed to %q, want %q", names, want)
+	}
+	groups := regionGroups(proxies, codes)
+	var got [][]string
+	for _, group := range groups {
+		got = append(got, append([]string{group["name"].(string)}, group["proxies"].([]string)...))
+	}
+	want := [][]string{
+		{"🇭🇰 香港", "🇭🇰 香港 01", "🇭🇰 node 3"},
+		{"🇯🇵 日本", "🇯🇵 node 2"},
+		{"🇧🇷 BR", "🇧🇷 node 1"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("regionGroups = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"strings"
+)
+
+// routeQuery is the destination a rule list is evaluated against.
+type routeQuery struct {
+	Domain string
+	IP     netip.Addr
+
+	// Resolve, if set, looks up Domain the first time a rule without
+	// no-resolve needs an IP, like Clash does.
+	Resolve func(domain string) (netip.Addr, error)
+	GeoIP   *geoIP
+
+	resolved   bool
+	resolveErr error
+}
+
+func newRouteQuery(target string) *routeQuery {
+	q := &routeQuery{}
+	if ip, err := netip.ParseAddr(target); err == nil {
+		q.IP = ip.Unmap()
+	} else {
+		q.Domain = strings.TrimSuffix(strings.ToLower(target), ".")
+	}
+	return q
+}
+
+func (q *routeQuery) ip(noResolve bool) netip.Addr {
+	if q.IP.IsValid() || q.resolved || noResolve || q.Resolve == nil {
+		return q.IP
+	}
+	q.resolved = true
+	ip, err := q.Resolve(q.Domain)
+	if err != nil {
+		q.resolveErr = err
+		return q.IP
+	}
+	q.IP = ip.Unmap()
+	return q.IP
+}
+
+// unresolved explains why a rule resolving domains got no IP for q, it
+// is empty if the rule has no-resolve or q is an IP.
+func (q *routeQuery) unresolved(noResolve bool) string {
+	switch {
+	case q.IP.IsValid() || noResolve || q.Domain == "":
+		return ""
+	case q.Resolve == nil:
+		return "needs -resolve"
+	}
+	return "domain not resolved"
+}
+
+// match reports whether r matches q. A non-empty skip explains why the
+// rule could not be evaluated locally.
+func (r rule) match(q *routeQuery) (matched bool, skip string) {
+	switch r.Type {
+	case "DOMAIN":
+		return q.Domain != "" && q.Domain == r.Payload, ""
+	case "DOMAIN-SUFFIX":
+		return q.Domain != "" && (q.Domain == r.Payload || strings.HasSuffix(q.Domain, "."+r.Payload)), ""
+	case "DOMAIN-KEYWORD":
+		return q.Domain != "" && strings.Contains(q.Domain, r.Payload), ""
+	case "IP-CIDR", "IP-CIDR6":
+		ip := q.ip(r.noResolve())
+		return ip.IsValid() && r.prefix.Contains(ip), q.unresolved(r.noResolve())
+	case "GEOIP":
+		if q.GeoIP == nil {
+			return false, "no -mmdb given"
+		}
+		ip := q.ip(r.noResolve())
+		return ip.IsValid() && strings.EqualFold(q.GeoIP.Country(ip), r.Payload), q.unresolved(r.noResolve())
+	case "MATCH":
+		return true, ""
+	case "":
+		return false, "malformed rule"
+	}
+	return false, "rule type not supported locally"
+}
+
+// routeResult is the first rule matching a query.
+type routeResult struct {
+	Index   int
+	Rule    rule
+	Skipped []string
+}
+
+func route(rules []rule, q *routeQuery) *routeResult {
+	result := &routeResult{Index: -1}
+	for i, r := range rules {
+		matched, skip := r.match(q)
+		if skip != "" {
+			result.Skipped = append(result.Skipped, fmt.Sprintf("rules[%d] %q: %s", i, r.Raw, skip))
+			continue
+		}
+		if matched {
+			result.Index = i
+			result.Rule = r
+			return result
+		}
+	}
+	return result
+}
+
+// resolvePolicy follows select groups to their default member and
+// returns the chain, e.g. ["翻墙机场 (select)", "自动选择 (url-test)"].
+func resolvePolicy(config *clashConfig, name string) []string {
+	groups := make(map[string]map[string]interface{})
+	if config != nil {
+		for _, group := range config.ProxyGroups {
+			if n, ok := group["name"].(string); ok {
+				groups[n] = group
+			}
+		}
+	}
+	var chain []string
+	seen := make(map[string]bool)
+	for {
+		group, ok := groups[name]
+		if !ok || seen[name] {
+			return append(chain, name)
+		}
+		seen[name] = true
+		kind := fmt.Sprint(group["type"])
+		chain = append(chain, fmt.Sprintf("%s (%s)", name, kind))
+		members, _ := group["proxies"].([]interface{})
+		if kind != "select" || len(members) == 0 {
+			return chain
+		}
+		name = fmt.Sprint(members[0])
+	}
+}
+
+func routeMain(args []string) {
+	fs := flag.NewFlagSet("airport2clash route", flag.ExitOnError)
+	configFile := fs.String("config", "", "Clash config to take rules and groups from, defaults to the template rules")
+	mmdb := fs.String("mmdb", "", "MaxMind country database for GEOIP rules, e.g. Country.mmdb")
+	resolve := fs.Bool("resolve", false, "resolve domains for IP rules without no-resolve")
+	fs.Usage = func() {
+		_, _ = fmt.Fprintln(fs.Output(), "usage: airport2clash route [flags] domain|ip...")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	var config *clashConfig
+	rawRules := defaultRules()
+	if *configFile != "" {
+		var err error
+		config, err = loadClashConfig(*configFile)
+		if err != nil {
+			panic(err)
+		}
+		rawRules = config.Rules
+	}
+	rules := make([]rule, 0, len(rawRules))
+	for _, s := range rawRules {
+		// keep unparsable rules so that indexes match the config
+		r, err := parseRule(s)
+		if err != nil {
+			r = rule{Raw: s}
+		}
+		rules = append(rules, r)
+	}
+
+	var geo *geoIP
+	if *mmdb != "" {
+		var err error
+		geo, err = openGeoIP(*mmdb)
+		if err != nil {
+			panic(err)
+		}
+		defer geo.Close()
+	}
+
+	for _, target := range fs.Args() {
+		q := newRouteQuery(target)
+		q.GeoIP = geo
+		if *resolve {
+			q.Resolve = lookupIP
+		}
+		result := route(rules, q)
+		fmt.Println(target)
+		if q.Domain != "" && q.IP.IsValid() {
+			fmt.Printf("  resolved: %s\n", q.IP)
+		}
+		if q.resolveErr != nil {
+			fmt.Printf("  resolved: %s\n", q.resolveErr)
+		}
+		for _, s := range result.Skipped {
+			fmt.Printf("  skipped:  %s\n", s)
+		}
+		if result.Index == -1 {
+			fmt.Println("  no rule matches")
+			continue
+		}
+		fmt.Printf("  rule:     rules[%d] %s\n", result.Index, result.Rule.Raw)
+		fmt.Printf("  policy:   %s\n", strings.Join(resolvePolicy(config, result.Rule.Target), " -> "))
+	}
+}
+
+func lookupIP(domain string) (netip.Addr, error) {
+	ips, err := net.DefaultResolver.LookupNetIP(context.Background(), "ip", domain)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	if len(ips) == 0 {
+		return netip.Addr{}, fmt.Errorf("no address for %s", domain)
+	}
+	return ips[0], nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"net/netip"
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func parseRules(t *testing.T, raw ...string) []rule {
+	t.Helper()
+	rules := make([]rule, len(raw))
+	for i, s := range raw {
+		r, err := parseRule(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rules[i] = r
+	}
+	return rules
+}
+
+func TestRoute(t *testing.T) {
+	rules := parseRules(t,
+		"DOMAIN,www.example.com,Proxy",
+		"DOMAIN-SUFFIX,example.org,DIRECT",
+		"DOMAIN-KEYWORD,google,Proxy",
+		"IP-CIDR,10.0.0.0/8,DIRECT,no-resolve",
+		"IP-CIDR,1.1.1.0/24,REJECT",
+		"GEOIP,CN,DIRECT",
+		"DST-PORT,22,DIRECT",
+		"MATCH,Final",
+	)
+	resolve := func(domain string) (netip.Addr, error) {
+		if domain == "one.example.net" {
+			return netip.MustParseAddr("1.1.1.1"), nil
+		}
+		return netip.Addr{}, errors.New("no such host")
+	}
+	tests := []struct {
+		target  string
+		resolve bool
+		index   int
+		skipped []string
+	}{
+		{target: "WWW.example.com.", index: 0},
+		{target: "a.example.org", index: 1},
+		{target: "example.org", index: 1},
+		{target: "mail.google.com", index: 2},
+		{target: "10.1.2.3", index: 3},
+		{target: "1.1.1.1", index: 4},
+		{
+			target: "8.8.8.8",
+			index:  7,
+			skipped: []string{
+				`rules[5] "GEOIP,CN,DIRECT": no -mmdb given`,
+				`rules[6] "DST-PORT,22,DIRECT": rule type not supported locally`,
+			},
+		},
+		{
+			target: "one.example.net",
+			index:  7,
+			skipped: []string{
+				`rules[4] "IP-CIDR,1.1.1.0/24,REJECT": needs -resolve`,
+				`rules[5] "GEOIP,CN,DIRECT": no -mmdb given`,
+				`rules[6] "DST-PORT,22,DIRECT": rule type not supported locally`,
+			},
+		},
+		{target: "one.example.net", resolve: true, index: 4},
+		{
+			target:  "two.example.net",
+			resolve: true,
+			index:   7,
+			skipped: []string{
+				`rules[4] "IP-CIDR,1.1.1.0/24,REJECT": domain not resolved`,
+				`rules[5] "GEOIP,CN,DIRECT": no -mmdb given`,
+				`rules[6] "DST-PORT,22,DIRECT": rule type not supported locally`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		q := newRouteQuery(tt.target)
+		if tt.resolve {
+			q.Resolve = resolve
+		}
+		result := route(rules, q)
+		if result.Index != tt.index || !reflect.DeepEqual(result.Skipped, tt.skipped) {
+			t.Errorf("route(%q, resolve %v) = rules[%d] skipping %q, want rules[%d] skipping %q",
+				tt.target, tt.resolve, result.Index, result.Skipped, tt.index, tt.skipped)
+		}
+	}
+
+	// the no-resolve rule does not resolve, the next one does
+	q := newRouteQuery("one.example.net")
+	calls := 0
+	q.Resolve = func(domain string) (netip.Addr, error) {
+		calls++
+		return resolve(domain)
+	}
+	if result := route(parseRules(t, "IP-CIDR,1.0.0.0/8,DIRECT,no-resolve", "IP-CIDR6,::/0,DIRECT", "IP-CIDR,1.1.1.0/24,REJECT"), q); result.Index != 2 || calls != 1 {
+		t.Errorf("matched rules[%d] after %d lookups, want rules[2] after 1", result.Index, calls)
+	}
+
+	if result := route(parseRules(t, "DOMAIN,a.com,DIRECT"), newRouteQuery("b.com")); result.Index != -1 {
+		t.Errorf("matched rules[%d], want none", result.Index)
+	}
+}
+
+func TestResolvePolicy(t *testing.T) {
+	config := &clashConfig{}
+	if err := yaml.Unmarshal([]byte(`proxy-groups:
+  - {name: 翻墙机场, type: select, proxies: [自动选择, 香港]}
+  - {name: 自动选择, type: url-test, proxies: [hk1, jp1]}
+  - {name: 香港, type: select, proxies: [hk1]}
+  - {name: loop, type: select, proxies: [loop2]}
+  - {name: loop2, type: select, proxies: [loop]}
+  - {name: empty, type: select}
+`), config); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		config *clashConfig
+		name   string
+		want   []string
+	}{
+		{config, "翻墙机场", []string{"翻墙机场 (select)", "自动选择 (url-test)"}},
+		{config, "香港", []string{"香港 (select)", "hk1"}},
+		{config, "DIRECT", []string{"DIRECT"}},
+		{config, "loop", []string{"loop (select)", "loop2 (select)", "loop"}},
+		{config, "empty", []string{"empty (select)"}},
+		{nil, "翻墙机场", []string{"翻墙机场"}},
+	}
+	for _, tt := range tests {
+		if got := resolvePolicy(tt.config, tt.name); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("resolvePolicy(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ruleTypes is the set of rule types understood by Clash and its forks.
+var ruleTypes = map[string]bool{
+	"DOMAIN":         true,
+	"DOMAIN-SUFFIX":  true,
+	"DOMAIN-KEYWORD": true,
+	"DOMAIN-REGEX":   true,
+	"GEOSITE":        true,
+	"GEOIP":          true,
+	"IP-CIDR":        true,
+	"IP-CIDR6":       true,
+	"IP-SUFFIX":      true,
+	"IP-ASN":         true,
+	"SRC-GEOIP":      true,
+	"SRC-IP-CIDR":    true,
+	"SRC-PORT":       true,
+	"DST-PORT":       true,
+	"IN-PORT":        true,
+	"NETWORK":        true,
+	"PROCESS-NAME":   true,
+	"PROCESS-PATH":   true,
+	"RULE-SET":       true,
+	"SCRIPT":         true,
+	"AND":            true,
+	"OR":             true,
+	"NOT":            true,
+	"MATCH":          true,
+}
+
+// builtinPolicies can be used as a rule target or group member without
+// being declared.
+var builtinPolicies = map[string]bool{
+	"DIRECT":       true,
+	"REJECT":       true,
+	"REJECT-DROP":  true,
+	"PASS":         true,
+	"COMPATIBLE":   true,
+	"GLOBAL":       true,
+	"REJECT-TINYP": true,
+}
+
+// rule is a single entry of the rules section, e.g.
+// "IP-CIDR,10.0.0.0/8,DIRECT,no-resolve".
+type rule struct {
+	Type    string
+	Payload string
+	Target  string
+	Params  []string
+	Raw     string
+
+	prefix netip.Prefix
+}
+
+func parseRule(s string) (rule, error) {
+	r := rule{Raw: s}
+	parts := strings.Split(s, ",")
+	for i := range parts {
+		parts[i] = strings.TrimSpace(parts[i])
+	}
+	r.Type = strings.ToUpper(parts[0])
+	if r.Type == "MATCH" || r.Type == "FINAL" {
+		if len(parts) < 2 {
+			return r, fmt.Errorf("rule %q: missing target", s)
+		}
+		r.Type = "MATCH"
+		r.Target = parts[1]
+		return r, nil
+	}
+	if r.Type == "AND" || r.Type == "OR" || r.Type == "NOT" {
+		// logic rules nest commas inside parentheses, the target
+		// follows the last closing one.
+		idx := strings.LastIndex(s, ")")
+		if idx == -1 || !strings.HasPrefix(s[idx+1:], ",") {
+			return r, fmt.Errorf("rule %q: malformed logic rule", s)
+		}
+		rest := strings.Split(s[idx+2:], ",")
+		r.Payload = strings.TrimSpace(s[len(parts[0])+1 : idx+1])
+		r.Target = strings.TrimSpace(rest[0])
+		r.Params = rest[1:]
+		return r, nil
+	}
+	if len(parts) < 3 {
+		return r, fmt.Errorf("rule %q: expected TYPE,PAYLOAD,TARGET", s)
+	}
+	if !ruleTypes[r.Type] {
+		return r, fmt.Errorf("rule %q: unknown rule type %q", s, parts[0])
+	}
+	r.Payload = parts[1]
+	r.Target = parts[2]
+	r.Params = parts[3:]
+	switch r.Type {
+	case "DOMAIN", "DOMAIN-SUFFIX", "DOMAIN-KEYWORD":
+		r.Payload = strings.ToLower(r.Payload)
+	case "IP-CIDR", "IP-CIDR6", "SRC-IP-CIDR":
+		prefix, err := netip.ParsePrefix(r.Payload)
+		if err != nil {
+			return r, fmt.Errorf("rule %q: malformed CIDR: %w", s, err)
+		}
+		if r.Type == "IP-CIDR" && !prefix.Addr().Is4() {
+			return r, fmt.Errorf("rule %q: IP-CIDR expects an IPv4 CIDR, use IP-CIDR6", s)
+		}
+		if r.Type == "IP-CIDR6" && !prefix.Addr().Is6() {
+			return r, fmt.Errorf("rule %q: IP-CIDR6 expects an IPv6 CIDR", s)
+		}
+		r.prefix = prefix.Masked()
+	}
+	return r, nil
+}
+
+func (r rule) noResolve() bool {
+	for _, p := range r.Params {
+		if p == "no-resolve" {
+			return true
+		}
+	}
+	return false
+}
+
+// String formats the rule the way it is written in a config.
+func (r rule) String() string {
+	if r.Type == "MATCH" {
+		return "MATCH," + r.Target
+	}
+	return strings.Join(append([]string{r.Type, r.Payload, r.Target}, r.Params...), ",")
+}
+
+// covers reports whether every request matched by o is also matched by
+// r, so that o can never be reached when it follows r.
+func (r rule) covers(o rule) bool {
+	switch r.Type {
+	case "MATCH":
+		return true
+	case "DOMAIN":
+		return o.Type == "DOMAIN" && o.Payload == r.Payload
+	case "DOMAIN-SUFFIX":
+		switch o.Type {
+		case "DOMAIN", "DOMAIN-SUFFIX":
+			return o.Payload == r.Payload || strings.HasSuffix(o.Payload, "."+r.Payload)
+		}
+	case "DOMAIN-KEYWORD":
+		switch o.Type {
+		case "DOMAIN", "DOMAIN-SUFFIX", "DOMAIN-KEYWORD":
+			return strings.Contains(o.Payload, r.Payload)
+		}
+	case "IP-CIDR", "IP-CIDR6", "SRC-IP-CIDR":
+		if (r.Type == "SRC-IP-CIDR") != (o.Type == "SRC-IP-CIDR") || !o.prefix.IsValid() {
+			return false
+		}
+		// a rule resolving domains matches more than a no-resolve one
+		if r.noResolve() && !o.noResolve() {
+			return false
+		}
+		return r.prefix.Bits() <= o.prefix.Bits() && r.prefix.Contains(o.prefix.Addr())
+	case "GEOIP":
+		if o.Type == "GEOIP" && strings.EqualFold(o.Payload, r.Payload) {
+			return !r.noResolve() || o.noResolve()
+		}
+		return false
+	}
+	return r.Type == o.Type && r.Payload == o.Payload && strings.Join(r.Params, ",") == strings.Join(o.Params, ",")
+}
+
+// defaultRules returns the rules embedded in the config template.
+func defaultRules() []string {
+	var rules []string
+	if err := yaml.Unmarshal([]byte(defaultRulesYaml), &rules); err != nil {
+		panic(err)
+	}
+	return rules
+}
+
+// renderRules formats rules as the items of a YAML block sequence.
+func renderRules(rules []string) string {
+	sb := &strings.Builder{}
+	for _, r := range rules {
+		sb.WriteString("  - '")
+		sb.WriteString(strings.ReplaceAll(r, "'", "''"))
+		sb.WriteString("'\n")
+	}
+	return sb.String()
+}
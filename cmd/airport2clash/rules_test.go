@@ -0,0 +1,85 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseRule(t *testing.T) {
+	tests := []struct {
+		s    string
+		want rule
+		err  string
+	}{
+		{s: "DOMAIN-SUFFIX, Google.COM ,Proxy", want: rule{Type: "DOMAIN-SUFFIX", Payload: "google.com", Target: "Proxy", Params: []string{}}},
+		{s: "ip-cidr,10.0.0.0/8,DIRECT,no-resolve", want: rule{Type: "IP-CIDR", Payload: "10.0.0.0/8", Target: "DIRECT", Params: []string{"no-resolve"}}},
+		{s: "FINAL,DIRECT", want: rule{Type: "MATCH", Target: "DIRECT"}},
+		{s: "AND,((DOMAIN,a.com),(NETWORK,UDP)),REJECT", want: rule{Type: "AND", Payload: "((DOMAIN,a.com),(NETWORK,UDP))", Target: "REJECT", Params: []string{}}},
+		{s: "DOMAIN-SUFIX,google.com,Proxy", err: `unknown rule type "DOMAIN-SUFIX"`},
+		{s: "IP-CIDR,10.0.0.0/33,DIRECT", err: "malformed CIDR"},
+		{s: "IP-CIDR,10.0.0.1,DIRECT", err: "malformed CIDR"},
+		{s: "IP-CIDR,2001:db8::/32,DIRECT", err: "IP-CIDR expects an IPv4 CIDR, use IP-CIDR6"},
+		{s: "IP-CIDR6,10.0.0.0/8,DIRECT", err: "IP-CIDR6 expects an IPv6 CIDR"},
+		{s: "DOMAIN,google.com", err: "expected TYPE,PAYLOAD,TARGET"},
+		{s: "MATCH", err: "missing target"},
+		{s: "AND,((DOMAIN,a.com)", err: "malformed logic rule"},
+	}
+	for _, tt := range tests {
+		r, err := parseRule(tt.s)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("parseRule(%q) error %v, want %q", tt.s, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseRule(%q): %v", tt.s, err)
+			continue
+		}
+		if r.Type != tt.want.Type || r.Payload != tt.want.Payload || r.Target != tt.want.Target || !reflect.DeepEqual(r.Params, tt.want.Params) {
+			t.Errorf("parseRule(%q) = %+v, want %+v", tt.s, r, tt.want)
+		}
+	}
+}
+
+func TestRuleCovers(t *testing.T) {
+	tests := []struct {
+		r, o string
+		want bool
+	}{
+		{"MATCH,DIRECT", "DOMAIN,a.com,P", true},
+		{"DOMAIN,a.com,P", "DOMAIN,A.com,DIRECT", true},
+		{"DOMAIN,a.com,P", "DOMAIN-SUFFIX,a.com,P", false},
+		{"DOMAIN-SUFFIX,a.com,P", "DOMAIN,www.a.com,P", true},
+		{"DOMAIN-SUFFIX,a.com,P", "DOMAIN-SUFFIX,a.com,P", true},
+		{"DOMAIN-SUFFIX,a.com,P", "DOMAIN,ba.com,P", false},
+		{"DOMAIN-KEYWORD,goo,P", "DOMAIN-SUFFIX,google.com,P", true},
+		{"DOMAIN-KEYWORD,goo,P", "DOMAIN-REGEX,goo,P", false},
+		{"IP-CIDR,10.0.0.0/8,P", "IP-CIDR,10.1.0.0/16,P", true},
+		{"IP-CIDR,10.1.0.0/16,P", "IP-CIDR,10.0.0.0/8,P", false},
+		{"IP-CIDR,10.0.0.0/8,P", "IP-CIDR,10.1.0.0/16,P,no-resolve", true},
+		{"IP-CIDR,10.0.0.0/8,P,no-resolve", "IP-CIDR,10.1.0.0/16,P", false},
+		{"IP-CIDR,10.0.0.0/8,P,no-resolve", "IP-CIDR,10.1.0.0/16,P,no-resolve", true},
+		{"IP-CIDR,10.0.0.0/8,P", "SRC-IP-CIDR,10.1.0.0/16,P", false},
+		{"IP-CIDR6,2001:db8::/32,P", "IP-CIDR6,2001:db8:1::/48,P", true},
+		{"GEOIP,CN,DIRECT", "GEOIP,cn,P,no-resolve", true},
+		{"GEOIP,CN,DIRECT,no-resolve", "GEOIP,CN,P", false},
+		{"GEOIP,CN,DIRECT", "IP-CIDR,10.0.0.0/8,P", false},
+		{"DST-PORT,443,P", "DST-PORT,443,DIRECT", true},
+		{"DST-PORT,443,P", "DST-PORT,80,DIRECT", false},
+	}
+	for _, tt := range tests {
+		r, err := parseRule(tt.r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		o, err := parseRule(tt.o)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := r.covers(o); got != tt.want {
+			t.Errorf("%q covers %q = %v, want %v", tt.r, tt.o, got, tt.want)
+		}
+	}
+}
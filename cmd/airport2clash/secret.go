@@ -0,0 +1,106 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// sourceEnv is read when neither -source nor -source-file is given, so
+// the subscription token stays out of shell history.
+const sourceEnv = "AIRPORT2CLASH_SOURCE"
+
+func resolveSource(source, sourceFile string) (string, error) {
+	if source != "" {
+		return source, nil
+	}
+	if sourceFile != "" {
+		b, err := os.ReadFile(sourceFile)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(b)), nil
+	}
+	if source = os.Getenv(sourceEnv); source != "" {
+		return source, nil
+	}
+	return "", fmt.Errorf("no source, use -source, -source-file or $%s", sourceEnv)
+}
+
+const redacted = "REDACTED"
+
+// redactURL hides the parts of a subscription URL that usually carry
+// the account token: user info, query values and long path segments.
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return redacted
+	}
+	if u.User != nil {
+		u.User = url.User(redacted)
+	}
+	segments := strings.Split(u.Path, "/")
+	for i, segment := range segments {
+		if len(segment) >= 16 {
+			segments[i] = redacted
+		}
+	}
+	u.Path = strings.Join(segments, "/")
+	u.RawPath = ""
+	query := u.Query()
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, url.QueryEscape(key)+"="+redacted)
+	}
+	sort.Strings(keys)
+	u.RawQuery = strings.Join(keys, "&")
+	u.Fragment = ""
+	return u.String()
+}
+
+// redactError replaces every occurrence of source in err.
+func redactError(err error, source string) error {
+	if err == nil || source == "" || !strings.Contains(err.Error(), source) {
+		return err
+	}
+	return errors.New(strings.ReplaceAll(err.Error(), source, redactURL(source)))
+}
+
+func defaultSecretFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "airport2clash", "controller.secret")
+}
+
+// loadOrCreateSecret reads the external-controller secret from name,
+// generating and storing a random one on first use.
+func loadOrCreateSecret(name string) (string, error) {
+	b, err := os.ReadFile(name)
+	if err == nil {
+		if secret := strings.TrimSpace(string(b)); secret != "" {
+			return secret, nil
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+	key := make([]byte, 24)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	secret := hex.EncodeToString(key)
+	if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(name, []byte(secret+"\n"), 0600); err != nil {
+		return "", err
+	}
+	return secret, nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultSettings parses settingsYaml into a mapping node, keeping the
+// comments of the template.
+func defaultSettings() *yaml.Node {
+	doc := &yaml.Node{}
+	if err := yaml.Unmarshal([]byte(settingsYaml), doc); err != nil {
+		panic(err)
+	}
+	return doc.Content[0]
+}
+
+// mergeNode merges the mapping src into dst. Nested mappings are merged
+// key by key, any other value replaces the one in dst, and a null value
+// removes the key.
+func mergeNode(dst, src *yaml.Node) {
+	for i := 0; i+1 < len(src.Content); i += 2 {
+		key, value := src.Content[i], src.Content[i+1]
+		idx := mappingIndex(dst, key.Value)
+		switch {
+		case value.Tag == "!!null":
+			if idx != -1 {
+				dst.Content = append(dst.Content[:idx], dst.Content[idx+2:]...)
+			}
+		case idx == -1:
+			dst.Content = append(dst.Content, key, value)
+		case value.Kind == yaml.MappingNode && dst.Content[idx+1].Kind == yaml.MappingNode:
+			mergeNode(dst.Content[idx+1], value)
+		default:
+			dst.Content[idx+1] = value
+		}
+	}
+}
+
+func mappingIndex(node *yaml.Node, key string) int {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return i
+		}
+	}
+	return -1
+}
+
+func renderSettings(settings *yaml.Node) string {
+	buf := &bytes.Buffer{}
+	encoder := yaml.NewEncoder(buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(settings); err != nil {
+		panic(fmt.Sprintf("cannot render settings: %s", err))
+	}
+	return buf.String()
+}
+
+// mappingValue returns the value of key in the mapping node, or nil.
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if idx := mappingIndex(node, key); idx != -1 {
+		return node.Content[idx+1]
+	}
+	return nil
+}
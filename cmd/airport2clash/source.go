@@ -0,0 +1,43 @@
+package main
+
+import (
+	"flag"
+	"time"
+)
+
+// sourceFlags select and fetch the subscription, shared by the
+// subcommands reading it.
+type sourceFlags struct {
+	Source     string
+	SourceFile string
+	CacheDir   string
+	Fetch      fetchOptions
+}
+
+func (f *sourceFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.Source, "source", "", "subscription URL, defaults to $"+sourceEnv)
+	fs.StringVar(&f.SourceFile, "source-file", "", "read the subscription URL from this file")
+	fs.DurationVar(&f.Fetch.Timeout, "timeout", 30*time.Second, "timeout of each fetch attempt")
+	fs.IntVar(&f.Fetch.Retries, "retries", 2, "retries on network errors and 429/5xx responses")
+	fs.DurationVar(&f.Fetch.Backoff, "backoff", time.Second, "initial backoff between retries, doubled each time")
+	fs.StringVar(&f.Fetch.UserAgent, "user-agent", "", "User-Agent header, e.g. clash.meta")
+	fs.Var((*stringsFlags)(&f.Fetch.Headers), "header", "extra request header \"Key: Value\", may be repeated")
+	fs.StringVar(&f.Fetch.Proxy, "proxy", "", "fetch through proxy, e.g. http://127.0.0.1:7890 or socks5://127.0.0.1:7891")
+	fs.StringVar(&f.CacheDir, "cache-dir", defaultCacheDir(), "directory of cached subscriptions, empty to disable")
+}
+
+// resolve sets Source from -source-file or the environment.
+func (f *sourceFlags) resolve() error {
+	source, err := resolveSource(f.Source, f.SourceFile)
+	f.Source = source
+	return err
+}
+
+// load fetches and parses the subscription, errors are redacted.
+func (f *sourceFlags) load() ([]map[string]interface{}, error) {
+	body, err := loadSubscription(f.Source, f.Fetch, &subscriptionCache{Dir: f.CacheDir})
+	if err != nil {
+		return nil, redactError(err, f.Source)
+	}
+	return parseSubscription(body)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// pickState holds the node choices made with pick, by node name.
+type pickState struct {
+	Favorites []string `json:"favorites,omitempty"`
+	Excluded  []string `json:"excluded,omitempty"`
+}
+
+func defaultStateFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "airport2clash", "state.json")
+}
+
+// loadPickState returns an empty state if the file does not exist.
+func loadPickState(name string) (*pickState, error) {
+	state := &pickState{}
+	b, err := os.ReadFile(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, state); err != nil {
+		return nil, fmt.Errorf("corrupted state %s: %w", name, err)
+	}
+	return state, nil
+}
+
+func (s *pickState) store(name string) error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+		return err
+	}
+	return writeFileAtomic(name, append(b, '\n'), 0600)
+}
+
+// apply drops excluded nodes and moves favorites to the front, keeping
+// the subscription order otherwise.
+func (s *pickState) apply(proxies []map[string]interface{}) []map[string]interface{} {
+	excluded := make(map[string]bool, len(s.Excluded))
+	for _, name := range s.Excluded {
+		excluded[name] = true
+	}
+	favorite := make(map[string]bool, len(s.Favorites))
+	for _, name := range s.Favorites {
+		favorite[name] = true
+	}
+	kept := make([]map[string]interface{}, 0, len(proxies))
+	for _, proxy := range proxies {
+		if !excluded[proxy["name"].(string)] {
+			kept = append(kept, proxy)
+		}
+	}
+	sort.SliceStable(kept, func(i, j int) bool {
+		return favorite[kept[i]["name"].(string)] && !favorite[kept[j]["name"].(string)]
+	})
+	return kept
+}
@@ -0,0 +1,17 @@
+//go:build !linux && !darwin
+
+package main
+
+import "errors"
+
+type termState struct{}
+
+var errNoTerm = errors.New("terminal UI is not supported on this platform")
+
+func isTerminal(fd int) bool { return false }
+
+func makeRaw(fd int) (*termState, error) { return nil, errNoTerm }
+
+func restoreTerm(fd int, state *termState) error { return errNoTerm }
+
+func termSize(fd int) (width, height int, err error) { return 0, 0, errNoTerm }
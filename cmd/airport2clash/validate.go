@@ -0,0 +1,178 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// clashConfig is the part of a Clash config that the linter and the
+// route tool care about.
+type clashConfig struct {
+	Proxies        []map[string]interface{} `yaml:"proxies"`
+	ProxyGroups    []map[string]interface{} `yaml:"proxy-groups"`
+	ProxyProviders map[string]interface{}   `yaml:"proxy-providers"`
+	Rules          []string                 `yaml:"rules"`
+}
+
+func loadClashConfig(name string) (*clashConfig, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	config := &clashConfig{}
+	if err := yaml.Unmarshal(b, config); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return config, nil
+}
+
+// problem is a single finding of validateConfig.
+type problem struct {
+	Warning bool
+	Where   string
+	Msg     string
+}
+
+func (p problem) String() string {
+	level := "error"
+	if p.Warning {
+		level = "warning"
+	}
+	return fmt.Sprintf("%s: %s: %s", level, p.Where, p.Msg)
+}
+
+// validateConfig checks proxy, group and rule references, duplicate
+// names, proxy chains, rule syntax and rules shadowed by an earlier one.
+func validateConfig(config *clashConfig) []problem {
+	var problems []problem
+	report := func(warning bool, where string, format string, args ...interface{}) {
+		problems = append(problems, problem{Warning: warning, Where: where, Msg: fmt.Sprintf(format, args...)})
+	}
+
+	policies := make(map[string]string)
+	for i, proxy := range config.Proxies {
+		where := fmt.Sprintf("proxies[%d]", i)
+		name, ok := proxy["name"].(string)
+		if !ok || name == "" {
+			report(false, where, "missing name")
+			continue
+		}
+		if _, ok := policies[name]; ok {
+			report(false, where, "duplicate proxy name %q", name)
+			continue
+		}
+		policies[name] = "proxy"
+	}
+	groups := make([]string, len(config.ProxyGroups))
+	for i, group := range config.ProxyGroups {
+		where := fmt.Sprintf("proxy-groups[%d]", i)
+		name, ok := group["name"].(string)
+		if !ok || name == "" {
+			report(false, where, "missing name")
+			continue
+		}
+		groups[i] = name
+		if kind, ok := policies[name]; ok {
+			report(false, where, "group name %q duplicates a %s", name, kind)
+			continue
+		}
+		policies[name] = "group"
+	}
+
+	for i, group := range config.ProxyGroups {
+		where := fmt.Sprintf("proxy-groups[%d] %q", i, groups[i])
+		members, _ := group["proxies"].([]interface{})
+		uses, _ := group["use"].([]interface{})
+		if len(members) == 0 && len(uses) == 0 {
+			report(false, where, "group has neither proxies nor use")
+		}
+		seen := make(map[string]bool)
+		for _, member := range members {
+			name := fmt.Sprint(member)
+			if seen[name] {
+				report(true, where, "%q is listed twice", name)
+			}
+			seen[name] = true
+			if name == groups[i] {
+				report(false, where, "group lists itself")
+			} else if _, ok := policies[name]; !ok && !builtinPolicies[name] {
+				report(false, where, "unknown proxy or group %q", name)
+			}
+		}
+		for _, use := range uses {
+			name := fmt.Sprint(use)
+			if _, ok := config.ProxyProviders[name]; !ok {
+				report(false, where, "unknown proxy provider %q", name)
+			}
+		}
+	}
+
+	for _, msg := range chainProblems(config.Proxies, config.ProxyGroups) {
+		report(false, "proxies", "%s", msg)
+	}
+
+	var parsed []rule
+	var parsedIdx []int
+	for i, s := range config.Rules {
+		where := fmt.Sprintf("rules[%d]", i)
+		r, err := parseRule(s)
+		if err != nil {
+			report(false, where, "%s", err)
+			continue
+		}
+		if _, ok := policies[r.Target]; !ok && !builtinPolicies[r.Target] {
+			report(false, where, "rule %q references unknown proxy or group %q", s, r.Target)
+		}
+		for j, earlier := range parsed {
+			if earlier.covers(r) {
+				report(true, where, "rule %q is unreachable, shadowed by rules[%d] %q", s, parsedIdx[j], earlier.Raw)
+				break
+			}
+		}
+		parsed = append(parsed, r)
+		parsedIdx = append(parsedIdx, i)
+	}
+	if len(parsed) > 0 && parsed[len(parsed)-1].Type != "MATCH" {
+		report(true, "rules", "no MATCH rule at the end")
+	}
+	return problems
+}
+
+func validateMain(args []string) {
+	fs := flag.NewFlagSet("airport2clash validate", flag.ExitOnError)
+	strict := fs.Bool("strict", false, "treat warnings as errors")
+	quiet := fs.Bool("quiet", false, "only print errors")
+	fs.Usage = func() {
+		_, _ = fmt.Fprintln(fs.Output(), "usage: airport2clash validate [flags] config.yaml...")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	failed := false
+	for _, name := range fs.Args() {
+		config, err := loadClashConfig(name)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "error: %s\n", err)
+			failed = true
+			continue
+		}
+		for _, p := range validateConfig(config) {
+			if !p.Warning || *strict {
+				failed = true
+			} else if *quiet {
+				continue
+			}
+			_, _ = fmt.Fprintf(os.Stderr, "%s: %s\n", name, p)
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
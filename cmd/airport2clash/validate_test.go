@@ -0,0 +1,122 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func validateYaml(t *testing.T, s string) []string {
+	t.Helper()
+	config := &clashConfig{}
+	if err := yaml.Unmarshal([]byte(s), config); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, p := range validateConfig(config) {
+		got = append(got, p.String())
+	}
+	return got
+}
+
+func TestValidateConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		want   []string
+	}{
+		{
+			name: "valid",
+			config: `proxies:
+  - {name: hk, type: ss}
+proxy-groups:
+  - {name: Proxy, type: select, proxies: [hk, DIRECT]}
+rules:
+  - 'DOMAIN-SUFFIX,google.com,Proxy'
+  - 'IP-CIDR,10.0.0.0/8,DIRECT,no-resolve'
+  - 'MATCH,Proxy'
+`,
+		},
+		{
+			name: "unknown group and proxy",
+			config: `proxies:
+  - {name: hk, type: ss}
+proxy-groups:
+  - {name: Proxy, type: select, proxies: [hk, jp]}
+rules:
+  - 'DOMAIN-SUFFIX,google.com,Proxies'
+  - 'MATCH,Proxy'
+`,
+			want: []string{
+				`error: proxy-groups[0] "Proxy": unknown proxy or group "jp"`,
+				`error: rules[0]: rule "DOMAIN-SUFFIX,google.com,Proxies" references unknown proxy or group "Proxies"`,
+			},
+		},
+		{
+			name: "duplicate names",
+			config: `proxies:
+  - {name: hk, type: ss}
+  - {name: hk, type: trojan}
+  - {type: ss}
+proxy-groups:
+  - {name: hk, type: select, proxies: [DIRECT]}
+rules:
+  - 'MATCH,DIRECT'
+`,
+			want: []string{
+				`error: proxies[1]: duplicate proxy name "hk"`,
+				`error: proxies[2]: missing name`,
+				`error: proxy-groups[0]: group name "hk" duplicates a proxy`,
+			},
+		},
+		{
+			name: "bad rules",
+			config: `rules:
+  - 'DOMAIN-SUFIX,google.com,DIRECT'
+  - 'IP-CIDR,10.0.0.0/33,DIRECT'
+  - 'IP-CIDR,2001:db8::/32,DIRECT'
+  - 'MATCH,DIRECT'
+`,
+			want: []string{
+				`error: rules[0]: rule "DOMAIN-SUFIX,google.com,DIRECT": unknown rule type "DOMAIN-SUFIX"`,
+				`error: rules[1]: rule "IP-CIDR,10.0.0.0/33,DIRECT": malformed CIDR: netip.ParsePrefix("10.0.0.0/33"): prefix length out of range`,
+				`error: rules[2]: rule "IP-CIDR,2001:db8::/32,DIRECT": IP-CIDR expects an IPv4 CIDR, use IP-CIDR6`,
+			},
+		},
+		{
+			name: "shadowed rule",
+			config: `rules:
+  - 'DOMAIN-SUFFIX,google.com,DIRECT'
+  - 'DOMAIN,www.google.com,REJECT'
+  - 'DOMAIN-KEYWORD,google,REJECT'
+`,
+			want: []string{
+				`warning: rules[1]: rule "DOMAIN,www.google.com,REJECT" is unreachable, shadowed by rules[0] "DOMAIN-SUFFIX,google.com,DIRECT"`,
+				`warning: rules: no MATCH rule at the end`,
+			},
+		},
+		{
+			name: "no-resolve",
+			config: `rules:
+  - 'IP-CIDR,10.0.0.0/8,DIRECT,no-resolve'
+  - 'IP-CIDR,10.1.0.0/16,REJECT'
+  - 'IP-CIDR,10.0.0.0/8,REJECT'
+  - 'IP-CIDR,10.2.0.0/16,REJECT,no-resolve'
+  - 'MATCH,DIRECT'
+`,
+			// only a no-resolve rule is shadowed by a no-resolve one
+			want: []string{
+				`warning: rules[3]: rule "IP-CIDR,10.2.0.0/16,REJECT,no-resolve" is unreachable, shadowed by rules[0] "IP-CIDR,10.0.0.0/8,DIRECT,no-resolve"`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := validateYaml(t, tt.config)
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("problems:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// gitOutput runs git in dir and returns its trimmed standard output,
+// standard error is folded into the error.
+func gitOutput(dir string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git %s: %s", strings.Join(args, " "), msg)
+		}
+		return "", fmt.Errorf("git %s: %w", strings.Join(args, " "), err)
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// sameRepo reports whether two clone URLs point at the same
+// repository, so that an ssh remote matches its https URL.
+func sameRepo(a, b string) bool {
+	if a == b {
+		return true
+	}
+	ua, err := Parse(a)
+	if err != nil {
+		return false
+	}
+	ub, err := Parse(b)
+	if err != nil {
+		return false
+	}
+	pa, err := repoPath(ua)
+	if err != nil {
+		return false
+	}
+	pb, err := repoPath(ub)
+	return err == nil && pa == pb
+}
+
+// updateRepo fast-forwards the working tree of dir, or fetches a bare
+// repository.
+func updateRepo(dir string, stdout, stderr io.Writer) error {
+	args := []string{"pull", "--ff-only"}
+	if isBareRepo(dir) {
+		args = fetchArgs(dir)
+	}
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	return cmd.Run()
+}
+
+// existingClone reports whether target already holds a clone of
+// source. A missing or empty directory is not a clone, anything else
+// that is not a clone of source is an error.
+func existingClone(target, source string) (bool, error) {
+	entries, err := os.ReadDir(target)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if len(entries) == 0 {
+		return false, nil
+	}
+	if !isRepo(target) {
+		return false, fmt.Errorf("%s exists and is not a git repository", target)
+	}
+	remote, err := gitOutput(target, "config", "--get", "remote.origin.url")
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", target, err)
+	}
+	if !sameRepo(remote, source) {
+		return false, fmt.Errorf("%s is a clone of %s, not %s", target, remote, source)
+	}
+	return true, nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSameRepo(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"https://github.com/foo/bar", "https://github.com/foo/bar", true},
+		{"git@github.com:foo/bar.git", "https://github.com/foo/bar", true},
+		{"ssh://git@github.com:22/foo/bar.git", "https://GitHub.com/foo/bar/", true},
+		{"git@github.com:foo/bar.git", "https://github.com/foo/baz", false},
+		{"git@github.com:foo/bar.git", "https://gitlab.com/foo/bar", false},
+		{"/srv/git/foo/bar", "https://github.com/foo/bar", false},
+		{"/srv/git/foo/bar", "/srv/git/foo/bar", true},
+	}
+	for _, tt := range tests {
+		if got := sameRepo(tt.a, tt.b); got != tt.want {
+			t.Errorf("sameRepo(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+// gitInit creates a repository in dir and runs git args in it.
+func gitInit(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	if out, err := exec.Command("git", "init", "--quiet", dir).CombinedOutput(); err != nil {
+		t.Fatalf("git init: %s", out)
+	}
+	if len(args) == 0 {
+		return
+	}
+	if out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput(); err != nil {
+		t.Fatalf("git %s: %s", strings.Join(args, " "), out)
+	}
+}
+
+// runGit runs git in dir with a fixed identity and returns its trimmed
+// output.
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	args = append([]string{"-C", dir, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)
+	out, err := exec.Command("git", args...).CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %s", strings.Join(args, " "), out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// commitFile writes name in the working tree dir and commits it.
+func commitFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, dir, "add", name)
+	runGit(t, dir, "commit", "--quiet", "-m", "update "+name)
+}
+
+// newUpstream creates a bare repository at path with one commit on
+// main.
+func newUpstream(t *testing.T, path string) {
+	t.Helper()
+	work := filepath.Join(t.TempDir(), "work")
+	gitInit(t, work, "checkout", "--quiet", "-b", "main")
+	commitFile(t, work, "README", "hello\n")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, work, "clone", "--quiet", "--bare", work, path)
+}
+
+func TestExistingClone(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	src := t.TempDir()
+	source := "https://github.com/foo/bar"
+
+	clone := filepath.Join(src, "clone")
+	gitInit(t, clone, "remote", "add", "origin", "git@github.com:foo/bar.git")
+	other := filepath.Join(src, "other")
+	gitInit(t, other, "remote", "add", "origin", "https://github.com/foo/baz")
+	noRemote := filepath.Join(src, "no-remote")
+	gitInit(t, noRemote)
+	empty := filepath.Join(src, "empty")
+	notRepo := filepath.Join(src, "not-repo")
+	for _, dir := range []string{empty, notRepo} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(notRepo, "README"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		target string
+		exists bool
+		err    string
+	}{
+		{target: clone, exists: true},
+		{target: filepath.Join(src, "missing")},
+		{target: empty},
+		{target: notRepo, err: "is not a git repository"},
+		{target: other, err: "is a clone of https://github.com/foo/baz"},
+		{target: noRemote, err: "remote.origin.url"},
+	}
+	for _, tt := range tests {
+		exists, err := existingClone(tt.target, source)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("existingClone(%s) error %v, want %q", filepath.Base(tt.target), err, tt.err)
+			}
+			continue
+		}
+		if err != nil || exists != tt.exists {
+			t.Errorf("existingClone(%s) = %v, %v, want %v", filepath.Base(tt.target), exists, err, tt.exists)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// readManifest returns the URLs or import paths of a manifest, one per
+// line. Blank lines and lines starting with # are skipped.
+func readManifest(r io.Reader) ([]string, error) {
+	var sources []string
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || seen[line] {
+			continue
+		}
+		seen[line] = true
+		sources = append(sources, line)
+	}
+	return sources, scanner.Err()
+}
+
+// cloneRepo clones source into target with the git clone arguments
+// args, creating the parents of target.
+func cloneRepo(source, target string, args []string, stdout, stderr io.Writer) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	args = append(append([]string{"clone"}, args...), "--", source, target)
+	cmd := exec.Command("git", args...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	return cmd.Run()
+}
+
+// gitFailure picks the reason out of the output of a failed git
+// command, the first fatal or error line.
+func gitFailure(output string) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	for _, line := range lines {
+		if strings.HasPrefix(line, "fatal: ") || strings.HasPrefix(line, "error: ") {
+			return line
+		}
+	}
+	return lines[len(lines)-1]
+}
+
+// manifestRepo is a manifest line with the URL to clone and where to
+// put it, or why those could not be found.
+type manifestRepo struct {
+	Line   string
+	URL    string
+	Target string
+	Err    error
+}
+
+// resolveManifest finds the destination of every source under src. A
+// source landing on the target of an earlier one, e.g.
+// git@github.com:a/b.git after https://github.com/a/b, is left out and
+// reported in duplicates.
+func resolveManifest(src string, sources []string) (repos []manifestRepo, duplicates []string) {
+	first := make(map[string]string)
+	for _, source := range sources {
+		url, target, err := destination(src, source)
+		if err == nil {
+			if prev, ok := first[target]; ok {
+				duplicates = append(duplicates, fmt.Sprintf("%s: same repository as %s", source, prev))
+				continue
+			}
+			first[target] = source
+		}
+		repos = append(repos, manifestRepo{Line: source, URL: url, Target: target, Err: err})
+	}
+	return repos, duplicates
+}
+
+// importRepo clones source into target unless it is already there and
+// reports which happened. The clone arguments of an existing clone are
+// not applied, which the status says.
+func importRepo(source, target string, args []string) (string, error) {
+	exists, err := existingClone(target, source)
+	if err != nil {
+		return "", err
+	}
+	if exists && len(args) > 0 {
+		return "exists (clone options ignored)", nil
+	}
+	if exists {
+		return "exists", nil
+	}
+	var output bytes.Buffer
+	if err := cloneRepo(source, target, args, &output, &output); err != nil {
+		return "", fmt.Errorf("%w: %s", err, gitFailure(output.String()))
+	}
+	return "cloned", nil
+}
+
+func importMain(args []string) {
+	fs := flag.NewFlagSet("src_git_clone import", flag.ExitOnError)
+	concurrency := fs.Int("concurrency", 4, "number of repositories cloned at once")
+	var opts cloneOptions
+	opts.register(fs)
+	fs.Usage = func() {
+		_, _ = fmt.Fprintln(fs.Output(), "usage: src_git_clone import [flags] [manifest] [-- git clone args]")
+		_, _ = fmt.Fprintln(fs.Output(), "reads URLs or import paths from manifest, or stdin if it is missing or -")
+		fs.PrintDefaults()
+	}
+	// split before parsing, flag.Parse would swallow a -- with no
+	// manifest in front of it
+	args, opts.Extra = splitExtra(args)
+	_ = fs.Parse(args)
+	if fs.NArg() > 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	cloneArgs, err := opts.args()
+	if err != nil {
+		panic(err)
+	}
+	var r io.Reader = os.Stdin
+	if name := fs.Arg(0); name != "" && name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			panic(err)
+		}
+		defer f.Close()
+		r = f
+	}
+	sources, err := readManifest(r)
+	if err != nil {
+		panic(err)
+	}
+	src, err := findSrc()
+	if err != nil {
+		panic(err)
+	}
+
+	repos, duplicates := resolveManifest(src, sources)
+	if len(duplicates) > 0 {
+		_, _ = fmt.Fprintln(os.Stderr, "skipping duplicates:")
+		for _, d := range duplicates {
+			_, _ = fmt.Fprintf(os.Stderr, "  %s\n", d)
+		}
+	}
+
+	if *concurrency < 1 {
+		*concurrency = 1
+	}
+	errs := make([]error, len(repos))
+	var mu sync.Mutex
+	done := 0
+	sem := make(chan struct{}, *concurrency)
+	var wg sync.WaitGroup
+	for i, repo := range repos {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, repo manifestRepo) {
+			defer func() { <-sem; wg.Done() }()
+			status, err := "", repo.Err
+			if err == nil {
+				status, err = importRepo(repo.URL, repo.Target, cloneArgs)
+			}
+			if err != nil {
+				status = "failed"
+				errs[i] = err
+			}
+			mu.Lock()
+			done++
+			fmt.Printf("[%d/%d] %s %s\n", done, len(repos), status, repo.Line)
+			mu.Unlock()
+		}(i, repo)
+	}
+	wg.Wait()
+
+	failed := 0
+	for i, err := range errs {
+		if err != nil {
+			if failed == 0 {
+				_, _ = fmt.Fprintln(os.Stderr, "failures:")
+			}
+			failed++
+			_, _ = fmt.Fprintf(os.Stderr, "  %s: %s\n", repos[i].Line, err)
+		}
+	}
+	fmt.Printf("%d repositories, %d failed\n", len(repos), failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadManifest(t *testing.T) {
+	manifest := `# backend
+https://github.com/foo/api.git
+  git@gitlab.com:group/sub/worker.git
+
+golang.org/x/tools
+https://github.com/foo/api.git
+`
+	got, err := readManifest(strings.NewReader(manifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"https://github.com/foo/api.git", "git@gitlab.com:group/sub/worker.git", "golang.org/x/tools"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestResolveManifest(t *testing.T) {
+	src := t.TempDir()
+	sources := []string{
+		"https://github.com/a/b",
+		"git@github.com:a/b.git",
+		"github.com/a/b",
+		"https://gitlab.com/a/b",
+		"github.com/a",
+	}
+	repos, duplicates := resolveManifest(src, sources)
+	var lines []string
+	for _, repo := range repos {
+		lines = append(lines, repo.Line)
+	}
+	if want := []string{"https://github.com/a/b", "https://gitlab.com/a/b", "github.com/a"}; !reflect.DeepEqual(lines, want) {
+		t.Errorf("kept %q, want %q", lines, want)
+	}
+	if want := filepath.Join(src, "github.com", "a", "b"); repos[0].Target != want || repos[0].Err != nil {
+		t.Errorf("target %q, %v, want %q", repos[0].Target, repos[0].Err, want)
+	}
+	// a line that cannot be resolved is kept for the workers to report
+	if repos[2].Err == nil {
+		t.Errorf("github.com/a resolved to %q", repos[2].Target)
+	}
+	want := []string{
+		"git@github.com:a/b.git: same repository as https://github.com/a/b",
+		"github.com/a/b: same repository as https://github.com/a/b",
+	}
+	if !reflect.DeepEqual(duplicates, want) {
+		t.Errorf("duplicates %q, want %q", duplicates, want)
+	}
+}
+
+func TestGitFailure(t *testing.T) {
+	output := `Cloning into '/src/example.com/foo/bar'...
+fatal: repository 'https://example.com/foo/bar/' not found
+`
+	if got, want := gitFailure(output), "fatal: repository 'https://example.com/foo/bar/' not found"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got, want := gitFailure("Killed\n"), "Killed"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestImportRepoExisting(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	target := filepath.Join(t.TempDir(), "github.com", "foo", "bar")
+	gitInit(t, target, "remote", "add", "origin", "git@github.com:foo/bar.git")
+	for _, tt := range []struct {
+		args []string
+		want string
+	}{
+		{nil, "exists"},
+		{[]string{"--depth", "1"}, "exists (clone options ignored)"},
+	} {
+		got, err := importRepo("https://github.com/foo/bar", target, tt.args)
+		if err != nil || got != tt.want {
+			t.Errorf("importRepo(%q) = %q, %v, want %q", tt.args, got, err, tt.want)
+		}
+	}
+}
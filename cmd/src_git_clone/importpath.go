@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// knownHosts maps hosts with a fixed layout to the number of path
+// elements of a repository root, they are resolved without a request.
+var knownHosts = map[string]int{
+	"github.com":    3,
+	"bitbucket.org": 3,
+	"codeberg.org":  3,
+}
+
+// isImportPath reports whether s looks like a bare import path such as
+// golang.org/x/tools, a host with a dot followed by a path. A colon in
+// the host means an scp-like URL.
+func isImportPath(s string) bool {
+	if strings.Contains(s, "://") || strings.HasPrefix(s, ".") || strings.HasPrefix(s, "/") {
+		return false
+	}
+	host, rest, ok := strings.Cut(s, "/")
+	return ok && rest != "" && strings.Contains(host, ".") && !strings.Contains(host, ":")
+}
+
+// metaImport is a <meta name="go-import" content="prefix vcs repo"> tag.
+type metaImport struct {
+	Prefix, VCS, RepoRoot string
+}
+
+// parseMetaGoImports reads the go-import tags in the head of an HTML
+// page, the way cmd/go does.
+func parseMetaGoImports(r io.Reader) ([]metaImport, error) {
+	d := xml.NewDecoder(r)
+	d.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		if strings.EqualFold(charset, "utf-8") || strings.EqualFold(charset, "ascii") {
+			return input, nil
+		}
+		return nil, fmt.Errorf("can't decode XML document using charset %q", charset)
+	}
+	d.Strict = false
+	d.AutoClose = xml.HTMLAutoClose
+	d.Entity = xml.HTMLEntity
+	var imports []metaImport
+	for {
+		t, err := d.RawToken()
+		if err != nil {
+			if err == io.EOF || len(imports) > 0 {
+				return imports, nil
+			}
+			return nil, err
+		}
+		if e, ok := t.(xml.StartElement); ok && strings.EqualFold(e.Name.Local, "body") {
+			return imports, nil
+		}
+		if e, ok := t.(xml.EndElement); ok && strings.EqualFold(e.Name.Local, "head") {
+			return imports, nil
+		}
+		e, ok := t.(xml.StartElement)
+		if !ok || !strings.EqualFold(e.Name.Local, "meta") {
+			continue
+		}
+		if attrValue(e.Attr, "name") != "go-import" {
+			continue
+		}
+		if f := strings.Fields(attrValue(e.Attr, "content")); len(f) == 3 {
+			imports = append(imports, metaImport{Prefix: f[0], VCS: f[1], RepoRoot: f[2]})
+		}
+	}
+}
+
+func attrValue(attrs []xml.Attr, name string) string {
+	for _, a := range attrs {
+		if strings.EqualFold(a.Name.Local, name) {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// importResolver turns an import path into a git repository URL and
+// the import path of the repository root.
+type importResolver struct {
+	Client *http.Client
+	// Insecure fetches the go-get page over http, for testing.
+	Insecure bool
+}
+
+var ErrNotGit = errors.New("not a git repository")
+
+// defaultResolverClient gives up on a go-get page that does not answer,
+// http.DefaultClient would wait forever.
+var defaultResolverClient = &http.Client{Timeout: 30 * time.Second}
+
+func (r *importResolver) resolve(importPath string) (repoURL, root string, err error) {
+	importPath = strings.TrimSuffix(importPath, "/")
+	elems := strings.Split(importPath, "/")
+	if n, ok := knownHosts[elems[0]]; ok {
+		if len(elems) < n {
+			return "", "", fmt.Errorf("invalid import path %q", importPath)
+		}
+		root = strings.TrimSuffix(strings.Join(elems[:n], "/"), ".git")
+		return "https://" + root, root, nil
+	}
+
+	scheme := "https"
+	if r.Insecure {
+		scheme = "http"
+	}
+	client := r.Client
+	if client == nil {
+		client = defaultResolverClient
+	}
+	resp, err := client.Get(scheme + "://" + importPath + "?go-get=1")
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("%s: %s", importPath, resp.Status)
+	}
+	imports, err := parseMetaGoImports(resp.Body)
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %w", importPath, err)
+	}
+	var match *metaImport
+	for i, m := range imports {
+		if m.VCS == "mod" {
+			continue
+		}
+		if m.Prefix != importPath && !strings.HasPrefix(importPath, m.Prefix+"/") {
+			continue
+		}
+		if match != nil {
+			return "", "", fmt.Errorf("%s: several go-import tags for %s", importPath, m.Prefix)
+		}
+		match = &imports[i]
+	}
+	if match == nil {
+		return "", "", fmt.Errorf("%s: no go-import tag", importPath)
+	}
+	if match.VCS != "git" {
+		return "", "", fmt.Errorf("%s: %w, vcs is %s", importPath, ErrNotGit, match.VCS)
+	}
+	return match.RepoRoot, match.Prefix, nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestIsImportPath(t *testing.T) {
+	tests := map[string]bool{
+		"github.com/foo/bar":         true,
+		"golang.org/x/tools":         true,
+		"github.com":                 false,
+		"github.com:foo/bar":         false,
+		"git@github.com:foo/bar.git": false,
+		"https://github.com/foo/bar": false,
+		"./foo/bar":                  false,
+		"/srv/git/bar":               false,
+		"foo/bar":                    false,
+	}
+	for s, want := range tests {
+		if got := isImportPath(s); got != want {
+			t.Errorf("isImportPath(%q) = %v, want %v", s, got, want)
+		}
+	}
+}
+
+func TestParseMetaGoImports(t *testing.T) {
+	page := `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="go-import" content="example.org/x/tools git https://git.example.org/tools">
+<meta name="go-import" content="example.org/x/tools mod https://proxy.example.org">
+<meta name="go-source" content="example.org/x/tools https://example.org/src">
+<meta name="go-import" content="broken">
+</head>
+<body>
+<meta name="go-import" content="example.org/ignored git https://example.org/ignored">
+</body>
+</html>`
+	got, err := parseMetaGoImports(strings.NewReader(page))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []metaImport{
+		{"example.org/x/tools", "git", "https://git.example.org/tools"},
+		{"example.org/x/tools", "mod", "https://proxy.example.org"},
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestImportResolver(t *testing.T) {
+	var host string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("go-get") != "1" {
+			http.NotFound(w, r)
+			return
+		}
+		meta := func(prefix, vcs, repo string) {
+			_, _ = fmt.Fprintf(w, "<meta name=\"go-import\" content=\"%s/%s %s %s\">\n", host, prefix, vcs, repo)
+		}
+		_, _ = fmt.Fprintln(w, "<html><head>")
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/x/tools"):
+			meta("x/tools", "git", "https://git.example.org/tools")
+			meta("x/tools", "mod", "https://proxy.example.org")
+		case strings.HasPrefix(r.URL.Path, "/hg/"):
+			meta("hg/repo", "hg", "https://hg.example.org/repo")
+		case strings.HasPrefix(r.URL.Path, "/twice/"):
+			meta("twice/a", "git", "https://git.example.org/a")
+			meta("twice/a", "git", "https://git.example.org/b")
+		}
+		_, _ = fmt.Fprintln(w, "</head></html>")
+	}))
+	defer server.Close()
+	host = strings.TrimPrefix(server.URL, "http://")
+	r := &importResolver{Client: server.Client(), Insecure: true}
+
+	tests := []struct {
+		path, repoURL, root, err string
+	}{
+		{path: "github.com/foo/bar/cmd/baz", repoURL: "https://github.com/foo/bar", root: "github.com/foo/bar"},
+		{path: "github.com/foo", err: `invalid import path "github.com/foo"`},
+		{path: host + "/x/tools", repoURL: "https://git.example.org/tools", root: host + "/x/tools"},
+		{path: host + "/x/tools/cmd/stringer", repoURL: "https://git.example.org/tools", root: host + "/x/tools"},
+		{path: host + "/x/toolsmith", err: "no go-import tag"},
+		{path: host + "/hg/repo", err: "not a git repository, vcs is hg"},
+		{path: host + "/twice/a", err: "several go-import tags"},
+		{path: host + "/missing", err: "no go-import tag"},
+	}
+	for _, tt := range tests {
+		repoURL, root, err := r.resolve(tt.path)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("resolve(%q) error = %v, want %q", tt.path, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("resolve(%q): %v", tt.path, err)
+			continue
+		}
+		if repoURL != tt.repoURL || root != tt.root {
+			t.Errorf("resolve(%q) = %q, %q, want %q, %q", tt.path, repoURL, root, tt.repoURL, tt.root)
+		}
+	}
+	if _, _, err := r.resolve(host + "/hg/repo"); !errors.Is(err, ErrNotGit) {
+		t.Errorf("resolve of an hg repository: %v, want ErrNotGit", err)
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// repoPath returns the canonical location of u relative to the src
+// root, <host>/<owner>/<repo>. The port is dropped, a ~user segment
+// becomes user and nested groups are kept, so
+//
+//	ssh://git@example.com:2222/~alice/tools.git
+//	git@gitlab.com:group/subgroup/project.git
+//
+// map to example.com/alice/tools and gitlab.com/group/subgroup/project.
+func repoPath(u *url.URL) (string, error) {
+	if u.Scheme == "file" {
+		return "", fmt.Errorf("local repository %q has no host", u.Path)
+	}
+	host := strings.ToLower(u.Hostname())
+	if host == "" {
+		return "", fmt.Errorf("missing host in %q", u.String())
+	}
+	p := strings.Trim(u.Path, "/")
+	p = strings.TrimSuffix(p, ".git")
+	parts := strings.Split(p, "/")
+	for i, part := range parts {
+		if i == 0 {
+			part = strings.TrimPrefix(part, "~")
+		}
+		if part == "" || part == "." || part == ".." {
+			return "", fmt.Errorf("invalid repository path %q", u.Path)
+		}
+		parts[i] = part
+	}
+	if len(parts) < 2 {
+		return "", fmt.Errorf("repository path %q has no owner", u.Path)
+	}
+	return filepath.Join(append([]string{host}, parts...)...), nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestRepoPath(t *testing.T) {
+	tests := []struct {
+		rawurl string
+		want   string
+	}{
+		{"https://github.com/foo/bar", "github.com/foo/bar"},
+		{"https://GitHub.com/foo/bar.git/", "github.com/foo/bar"},
+		{"ssh://git@example.com:2222/foo/bar.git", "example.com/foo/bar"},
+		{"https://example.com:8443/foo/bar", "example.com/foo/bar"},
+		{"ssh://git@example.com:2222/~alice/tools.git", "example.com/alice/tools"},
+		{"git@gitlab.com:group/subgroup/project.git", "gitlab.com/group/subgroup/project"},
+		{"https://gitlab.com/group/sub/subsub/project", "gitlab.com/group/sub/subsub/project"},
+		{"git@github.com:foo/bar.git", "github.com/foo/bar"},
+		{"git://git.example.org/foo/bar", "git.example.org/foo/bar"},
+		{"file:///srv/git/foo/bar.git", ""},
+		{"/srv/git/foo/bar.git", ""},
+		{"https://github.com/bar", ""},
+		{"https://github.com/foo/../bar", ""},
+		{"https://github.com/foo//bar", ""},
+		{"https:///foo/bar", ""},
+	}
+	for _, tt := range tests {
+		u, err := Parse(tt.rawurl)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.rawurl, err)
+			continue
+		}
+		got, err := repoPath(u)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("repoPath(%q) = %q, want an error", tt.rawurl, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("repoPath(%q): %v", tt.rawurl, err)
+			continue
+		}
+		if got != filepath.FromSlash(tt.want) {
+			t.Errorf("repoPath(%q) = %q, want %q", tt.rawurl, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+func listMain(args []string) {
+	fs := flag.NewFlagSet("src_git_clone list", flag.ExitOnError)
+	fullPath := fs.Bool("full-path", false, "print absolute paths")
+	remote := fs.Bool("remote", false, "print the origin URL after each repository")
+	fs.Usage = func() {
+		_, _ = fmt.Fprintln(fs.Output(), "usage: src_git_clone list [flags] [query]")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() > 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	src, err := findSrc()
+	if err != nil {
+		panic(err)
+	}
+	repos, err := walkRepos(src)
+	if err != nil {
+		panic(err)
+	}
+	if fs.NArg() == 1 {
+		repos = filterRepos(repos, fs.Arg(0))
+	}
+	for _, repo := range repos {
+		dir := filepath.Join(src, filepath.FromSlash(repo))
+		line := repo
+		if *fullPath {
+			line = dir
+		}
+		if *remote {
+			// a repository without origin is listed with an empty URL
+			url, _ := gitOutput(dir, "config", "--get", "remote.origin.url")
+			line += "\t" + url
+		}
+		fmt.Println(line)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Match ranks of a query against a repository path, lower is better.
+const (
+	matchExact = iota
+	matchSuffix
+	matchSubstring
+	matchFuzzy
+	noMatch
+)
+
+// matchRank ranks query against a slash separated repository path: the
+// whole path, trailing elements such as owner/repo or repo, a
+// substring, or the characters of query in order.
+func matchRank(repo, query string) int {
+	switch {
+	case repo == query:
+		return matchExact
+	case strings.HasSuffix(repo, "/"+query):
+		return matchSuffix
+	}
+	repo, query = strings.ToLower(repo), strings.ToLower(query)
+	if strings.Contains(repo, query) {
+		return matchSubstring
+	}
+	rest := repo
+	for _, c := range query {
+		i := strings.IndexRune(rest, c)
+		if i < 0 {
+			return noMatch
+		}
+		rest = rest[i+len(string(c)):]
+	}
+	return matchFuzzy
+}
+
+// matchRepos returns the repositories with the best rank no worse than
+// worst, in the order of repos.
+func matchRepos(repos []string, query string, worst int) []string {
+	best := worst + 1
+	var matches []string
+	for _, repo := range repos {
+		rank := matchRank(repo, query)
+		switch {
+		case rank > worst:
+		case rank < best:
+			best = rank
+			matches = []string{repo}
+		case rank == best:
+			matches = append(matches, repo)
+		}
+	}
+	return matches
+}
+
+// filterRepos returns the repositories matching query at all.
+func filterRepos(repos []string, query string) []string {
+	var matched []string
+	for _, repo := range repos {
+		if matchRank(repo, query) != noMatch {
+			matched = append(matched, repo)
+		}
+	}
+	return matched
+}
+
+// lookupRepo finds the single repository matching query, listing the
+// candidates in the error if there are several.
+func lookupRepo(src, query string, worst int) (string, error) {
+	repos, err := walkRepos(src)
+	if err != nil {
+		return "", err
+	}
+	matches := matchRepos(repos, query, worst)
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("no repository matches %q", query)
+	case 1:
+		return filepath.Join(src, filepath.FromSlash(matches[0])), nil
+	}
+	return "", fmt.Errorf("%q matches several repositories:\n\t%s", query, strings.Join(matches, "\n\t"))
+}
+
+func lookMain(args []string) {
+	fs := flag.NewFlagSet("src_git_clone look", flag.ExitOnError)
+	fs.Usage = func() {
+		_, _ = fmt.Fprintln(fs.Output(), "usage: src_git_clone look query")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	src, err := findSrc()
+	if err != nil {
+		panic(err)
+	}
+	dir, err := lookupRepo(src, fs.Arg(0), matchFuzzy)
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Println(dir)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestWalkRepos(t *testing.T) {
+	src := t.TempDir()
+	for _, dir := range []string{
+		"github.com/foo/bar/.git",
+		"github.com/foo/bar/vendor/nested/.git",
+		"gitlab.com/group/sub/project/.git",
+		"gitlab.com/group/notes",
+		".cache/github.com/foo/hidden/.git",
+	} {
+		if err := os.MkdirAll(filepath.Join(src, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a worktree or submodule has a .git file
+	if err := os.MkdirAll(filepath.Join(src, "example.com/a/worktree"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "example.com/a/worktree/.git"), []byte("gitdir: x\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// a bare clone has no .git
+	for _, dir := range []string{"example.com/b/mirror/objects", "example.com/b/mirror/refs"} {
+		if err := os.MkdirAll(filepath.Join(src, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(src, "example.com/b/mirror/HEAD"), []byte("ref: refs/heads/main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := walkRepos(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"example.com/a/worktree", "example.com/b/mirror", "github.com/foo/bar", "gitlab.com/group/sub/project"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestMatchRepos(t *testing.T) {
+	repos := []string{
+		"github.com/foo/bar",
+		"github.com/foo/barbaz",
+		"github.com/qux/bar",
+		"gitlab.com/group/sub/Project",
+	}
+	tests := []struct {
+		query string
+		worst int
+		want  []string
+	}{
+		{"github.com/foo/bar", matchFuzzy, []string{"github.com/foo/bar"}},
+		{"foo/bar", matchFuzzy, []string{"github.com/foo/bar"}},
+		{"bar", matchFuzzy, []string{"github.com/foo/bar", "github.com/qux/bar"}},
+		{"barb", matchFuzzy, []string{"github.com/foo/barbaz"}},
+		{"project", matchFuzzy, []string{"gitlab.com/group/sub/Project"}},
+		{"gsubp", matchFuzzy, []string{"gitlab.com/group/sub/Project"}},
+		{"gsubp", matchSuffix, nil},
+		{"barb", matchSuffix, nil},
+		{"zzz", matchFuzzy, nil},
+	}
+	for _, tt := range tests {
+		if got := matchRepos(repos, tt.query, tt.worst); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("matchRepos(%q, %d) = %q, want %q", tt.query, tt.worst, got, tt.want)
+		}
+	}
+}
@@ -2,10 +2,11 @@ package main
 
 import (
 	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"net/url"
 	"os"
-	"os/exec"
 	"os/user"
 	"path/filepath"
 	"regexp"
@@ -162,52 +163,112 @@ func findDefaultSrc() (string, error) {
 
 var findSrc = common.Alternatives(findAncestorSrc, findEnvSrc, findDefaultSrc)
 
+// destination returns the URL to clone and where to put it. A bare
+// import path that is not a local directory is resolved like go get
+// does and placed at SRC/<import path of the repository root>.
+func destination(src, source string) (string, string, error) {
+	if _, err := os.Stat(source); err != nil && isImportPath(source) {
+		repoURL, root, err := (&importResolver{}).resolve(source)
+		if err != nil {
+			return "", "", err
+		}
+		return repoURL, filepath.Join(src, filepath.FromSlash(root)), nil
+	}
+	u, err := Parse(source)
+	if err != nil {
+		return "", "", fmt.Errorf("url parse failed %s", err)
+	}
+	rel, err := repoPath(u)
+	if err != nil {
+		return "", "", err
+	}
+	return source, filepath.Join(src, rel), nil
+}
+
+// subcommands maps the first argument to its entry point, a bare
+// invocation clones a repository.
+var subcommands = map[string]func(args []string){
+	"import": importMain,
+	"list":   listMain,
+	"look":   lookMain,
+	"rm":     rmMain,
+	"status": statusMain,
+	"sync":   syncMain,
+}
+
 func main() {
-	src, err := findSrc()
+	if len(os.Args) > 1 {
+		if cmd, ok := subcommands[os.Args[1]]; ok {
+			cmd(os.Args[2:])
+			return
+		}
+	}
+	cloneMain(os.Args[1:])
+}
+
+func cloneMain(args []string) {
+	fs := flag.NewFlagSet("src_git_clone", flag.ExitOnError)
+	update := fs.Bool("update", false, "fetch and fast-forward an existing clone")
+	printPath := fs.Bool("print-path", false, "only print the repository path on stdout, git output goes to stderr")
+	shell := fs.String("shell", "", "print the srccd function for sh, bash, zsh or fish and exit")
+	var opts cloneOptions
+	opts.register(fs)
+	fs.Usage = func() {
+		_, _ = fmt.Fprintln(fs.Output(), "usage: src_git_clone [flags] url|import-path [-- git clone args]")
+		_, _ = fmt.Fprintln(fs.Output(), "       src_git_clone import|list|look|rm|status|sync ...")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if *shell != "" {
+		f, err := shellFunction(*shell)
+		if err != nil {
+			panic(err)
+		}
+		fmt.Print(f)
+		return
+	}
+	positional, extra := splitExtra(fs.Args())
+	if len(positional) != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	opts.Extra = extra
+	cloneArgs, err := opts.args()
 	if err != nil {
 		panic(err)
 	}
-	if len(os.Args) <= 1 {
-		_, _ = fmt.Fprintln(os.Stderr, "src_git_clone url")
-		os.Exit(1)
+	src, err := findSrc()
+	if err != nil {
+		panic(err)
 	}
-	source := os.Args[1]
-	u, err := Parse(source)
+	source, target, err := destination(src, positional[0])
 	if err != nil {
-		panic(fmt.Sprintf("url parse failed %s", err))
+		panic(err)
 	}
-	var parent string
-	idx := strings.LastIndex(u.Path, "/")
-	if idx > 0 {
-		parent = u.Path[0:idx]
+	exists, err := existingClone(target, source)
+	if err != nil {
+		panic(err)
 	}
-	parents := append([]string{src, simpleHost(u.Host)}, strings.Split(parent, "/")...)
-	path := filepath.Join(parents...)
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		err = os.MkdirAll(path, 0755)
-		if err != nil {
-			panic(err)
+	if exists {
+		if len(cloneArgs) > 0 {
+			_, _ = fmt.Fprintf(os.Stderr, "warning: %s already exists, ignoring git clone %s\n", target, strings.Join(cloneArgs, " "))
 		}
+		if *update {
+			if err := updateRepo(target, os.Stderr, os.Stderr); err != nil {
+				panic(err)
+			}
+		}
+		fmt.Println(target)
+		return
+	}
+	var stdout io.Writer = os.Stdout
+	if *printPath {
+		stdout = os.Stderr
 	}
-	parts := strings.Split(u.Path, "/")
-	target := filepath.Join(append([]string{u.Host}, parts...)...)
-	idx = strings.LastIndex(target, ".")
-	if idx > 0 {
-		target = target[0:idx]
-	}
-	cmd := exec.Command("git", "clone", source)
-	cmd.Dir = path
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	if err := cmd.Run(); err != nil {
+	if err := cloneRepo(source, target, cloneArgs, stdout, os.Stderr); err != nil {
 		panic(err)
 	}
-}
-
-func simpleHost(host string) string {
-	idx := strings.Index(host, ":")
-	if idx != -1 {
-		host = host[0:idx]
+	if *printPath {
+		fmt.Println(target)
 	}
-	return host
 }
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"strconv"
+)
+
+// cloneOptions are passed on to git clone, the destination stays the
+// canonical one whatever they are.
+type cloneOptions struct {
+	Depth             int
+	Branch            string
+	RecurseSubmodules bool
+	Filter            string
+	Bare              bool
+	Mirror            bool
+	// Extra are the arguments given after --, passed as is.
+	Extra []string
+}
+
+func (o *cloneOptions) register(fs *flag.FlagSet) {
+	fs.IntVar(&o.Depth, "depth", 0, "create a shallow clone with this many commits")
+	fs.StringVar(&o.Branch, "branch", "", "check out this branch or tag instead of the remote HEAD")
+	fs.BoolVar(&o.RecurseSubmodules, "recurse-submodules", false, "initialize and clone submodules")
+	fs.StringVar(&o.Filter, "filter", "", "partial clone filter, e.g. blob:none")
+	fs.BoolVar(&o.Bare, "bare", false, "make a bare repository")
+	fs.BoolVar(&o.Mirror, "mirror", false, "make a bare mirror of all refs")
+}
+
+// splitExtra separates the arguments after -- from the positional ones.
+// flag.Parse stops at the first positional argument so a -- following
+// it is left in args.
+func splitExtra(args []string) (positional, extra []string) {
+	for i, arg := range args {
+		if arg == "--" {
+			return args[:i], args[i+1:]
+		}
+	}
+	return args, nil
+}
+
+func (o *cloneOptions) args() ([]string, error) {
+	var args []string
+	if o.Depth < 0 {
+		return nil, errors.New("negative depth")
+	}
+	if o.Depth > 0 {
+		args = append(args, "--depth", strconv.Itoa(o.Depth))
+	}
+	if o.Branch != "" {
+		args = append(args, "--branch", o.Branch)
+	}
+	if o.RecurseSubmodules {
+		if o.Bare || o.Mirror {
+			return nil, errors.New("a bare repository has no submodules")
+		}
+		args = append(args, "--recurse-submodules")
+	}
+	if o.Filter != "" {
+		args = append(args, "--filter="+o.Filter)
+	}
+	switch {
+	case o.Mirror:
+		args = append(args, "--mirror")
+	case o.Bare:
+		args = append(args, "--bare")
+	}
+	return append(args, o.Extra...), nil
+}
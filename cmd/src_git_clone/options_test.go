@@ -0,0 +1,45 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitExtra(t *testing.T) {
+	positional, extra := splitExtra([]string{"github.com/foo/bar", "--", "--single-branch", "--no-tags"})
+	if !reflect.DeepEqual(positional, []string{"github.com/foo/bar"}) || !reflect.DeepEqual(extra, []string{"--single-branch", "--no-tags"}) {
+		t.Errorf("got %q, %q", positional, extra)
+	}
+	positional, extra = splitExtra([]string{"github.com/foo/bar"})
+	if len(positional) != 1 || extra != nil {
+		t.Errorf("got %q, %q", positional, extra)
+	}
+}
+
+func TestCloneOptionsArgs(t *testing.T) {
+	tests := []struct {
+		opts cloneOptions
+		want []string
+		err  bool
+	}{
+		{opts: cloneOptions{}, want: nil},
+		{
+			opts: cloneOptions{Depth: 1, Branch: "v1.2.0", RecurseSubmodules: true, Filter: "blob:none", Extra: []string{"--no-tags"}},
+			want: []string{"--depth", "1", "--branch", "v1.2.0", "--recurse-submodules", "--filter=blob:none", "--no-tags"},
+		},
+		{opts: cloneOptions{Bare: true}, want: []string{"--bare"}},
+		{opts: cloneOptions{Bare: true, Mirror: true}, want: []string{"--mirror"}},
+		{opts: cloneOptions{Depth: -1}, err: true},
+		{opts: cloneOptions{Mirror: true, RecurseSubmodules: true}, err: true},
+	}
+	for _, tt := range tests {
+		got, err := tt.opts.args()
+		if (err != nil) != tt.err {
+			t.Errorf("%+v: error %v", tt.opts, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%+v: got %q, want %q", tt.opts, got, tt.want)
+		}
+	}
+}
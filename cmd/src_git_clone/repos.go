@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// isRepo reports whether dir is the top of a working tree or a bare
+// repository.
+func isRepo(dir string) bool {
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+		return true
+	}
+	return isBareRepo(dir)
+}
+
+// isBareRepo reports whether dir is a repository without a working
+// tree, as made by -bare and -mirror.
+func isBareRepo(dir string) bool {
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+		return false
+	}
+	for _, name := range []string{"HEAD", "objects", "refs"} {
+		fi, err := os.Stat(filepath.Join(dir, name))
+		if err != nil || fi.IsDir() != (name != "HEAD") {
+			return false
+		}
+	}
+	return true
+}
+
+// walkRepos returns the repositories under src as slash separated
+// paths relative to it, in lexical order. Hidden directories and the
+// inside of repositories are skipped.
+func walkRepos(src string) ([]string, error) {
+	var repos []string
+	err := filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path != src && errors.Is(err, fs.ErrPermission) {
+				return fs.SkipDir
+			}
+			return err
+		}
+		if !d.IsDir() || path == src {
+			return nil
+		}
+		if strings.HasPrefix(d.Name(), ".") {
+			return fs.SkipDir
+		}
+		if isRepo(path) {
+			rel, err := filepath.Rel(src, path)
+			if err != nil {
+				return err
+			}
+			repos = append(repos, filepath.ToSlash(rel))
+			return fs.SkipDir
+		}
+		return nil
+	})
+	return repos, err
+}
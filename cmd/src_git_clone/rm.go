@@ -0,0 +1,90 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// unsafeToRemove describes local work that would be lost by removing
+// dir: uncommitted changes, stashes or commits not on any remote. A
+// bare repository is never known to be safe.
+func unsafeToRemove(dir string) (string, error) {
+	if isBareRepo(dir) {
+		// pushed branches cannot be told from fetched ones
+		return "no working tree to check", nil
+	}
+	status, err := gitOutput(dir, "status", "--porcelain")
+	if err != nil {
+		return "", err
+	}
+	if status != "" {
+		return "uncommitted changes", nil
+	}
+	stash, err := gitOutput(dir, "stash", "list")
+	if err != nil {
+		return "", err
+	}
+	if stash != "" {
+		return "stashed changes", nil
+	}
+	unpushed, err := gitOutput(dir, "log", "--oneline", "--branches", "--not", "--remotes")
+	if err != nil {
+		return "", err
+	}
+	if unpushed != "" {
+		return "commits not pushed to any remote", nil
+	}
+	return "", nil
+}
+
+// removeEmptyParents removes the directories between dir and src that
+// became empty.
+func removeEmptyParents(src, dir string) {
+	src = filepath.Clean(src)
+	for parent := filepath.Dir(dir); parent != src && len(parent) > len(src); parent = filepath.Dir(parent) {
+		if os.Remove(parent) != nil {
+			return
+		}
+	}
+}
+
+func rmMain(args []string) {
+	fs := flag.NewFlagSet("src_git_clone rm", flag.ExitOnError)
+	force := fs.Bool("force", false, "remove even with local changes")
+	fs.Usage = func() {
+		_, _ = fmt.Fprintln(fs.Output(), "usage: src_git_clone rm [flags] repo")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	src, err := findSrc()
+	if err != nil {
+		panic(err)
+	}
+	// no fuzzy matching, repo has to name the path or its last elements
+	dir, err := lookupRepo(src, fs.Arg(0), matchSuffix)
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if !*force {
+		reason, err := unsafeToRemove(dir)
+		if err != nil {
+			panic(err)
+		}
+		if reason != "" {
+			_, _ = fmt.Fprintf(os.Stderr, "%s has %s, use -force to remove it anyway\n", dir, reason)
+			os.Exit(1)
+		}
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		panic(err)
+	}
+	removeEmptyParents(src, dir)
+	_, _ = fmt.Fprintf(os.Stderr, "removed %s\n", dir)
+}
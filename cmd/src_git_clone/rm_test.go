@@ -0,0 +1,134 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestUnsafeToRemove(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	clone := func(t *testing.T) string {
+		upstream := filepath.Join(t.TempDir(), "bar.git")
+		newUpstream(t, upstream)
+		dir := filepath.Join(t.TempDir(), "bar")
+		runGit(t, ".", "clone", "--quiet", upstream, dir)
+		return dir
+	}
+
+	tests := []struct {
+		name   string
+		setup  func(t *testing.T, dir string)
+		reason string
+	}{
+		{name: "clean", setup: func(t *testing.T, dir string) {}},
+		{name: "pushed", setup: func(t *testing.T, dir string) {
+			commitFile(t, dir, "NEW", "new\n")
+			runGit(t, dir, "push", "--quiet", "origin", "main")
+		}},
+		{name: "modified", setup: func(t *testing.T, dir string) {
+			if err := os.WriteFile(filepath.Join(dir, "README"), []byte("changed\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}, reason: "uncommitted changes"},
+		{name: "untracked", setup: func(t *testing.T, dir string) {
+			if err := os.WriteFile(filepath.Join(dir, "notes.txt"), nil, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}, reason: "uncommitted changes"},
+		{name: "stash", setup: func(t *testing.T, dir string) {
+			if err := os.WriteFile(filepath.Join(dir, "README"), []byte("changed\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			runGit(t, dir, "stash", "--quiet")
+		}, reason: "stashed changes"},
+		{name: "unpushed commit", setup: func(t *testing.T, dir string) {
+			commitFile(t, dir, "NEW", "new\n")
+		}, reason: "commits not pushed to any remote"},
+		{name: "unpushed branch", setup: func(t *testing.T, dir string) {
+			runGit(t, dir, "checkout", "--quiet", "-b", "topic")
+			commitFile(t, dir, "NEW", "new\n")
+			runGit(t, dir, "checkout", "--quiet", "main")
+		}, reason: "commits not pushed to any remote"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := clone(t)
+			tt.setup(t, dir)
+			reason, err := unsafeToRemove(dir)
+			if err != nil || reason != tt.reason {
+				t.Errorf("unsafeToRemove = %q, %v, want %q", reason, err, tt.reason)
+			}
+		})
+	}
+}
+
+func TestUnsafeToRemoveBare(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	dir := t.TempDir()
+	upstream := filepath.Join(dir, "upstream.git")
+	newUpstream(t, upstream)
+	runGit(t, dir, "clone", "--quiet", "--bare", upstream, "bare")
+	runGit(t, dir, "clone", "--quiet", "--mirror", upstream, "mirror")
+	runGit(t, dir, "init", "--quiet", "--bare", "no-upstream")
+	for _, name := range []string{"bare", "mirror", "no-upstream"} {
+		reason, err := unsafeToRemove(filepath.Join(dir, name))
+		if err != nil || reason != "no working tree to check" {
+			t.Errorf("%s: unsafeToRemove = %q, %v", name, reason, err)
+		}
+	}
+}
+
+func TestRemoveEmptyParents(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "src")
+	for _, dir := range []string{
+		"github.com/foo/bar",
+		"github.com/qux/baz",
+		"gitlab.com/group/sub/project",
+	} {
+		if err := os.MkdirAll(filepath.Join(src, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	exists := func(dir string) bool {
+		_, err := os.Stat(filepath.Join(src, dir))
+		return err == nil
+	}
+
+	// the owner goes, the host still holds a sibling
+	if err := os.RemoveAll(filepath.Join(src, "github.com/foo/bar")); err != nil {
+		t.Fatal(err)
+	}
+	removeEmptyParents(src, filepath.Join(src, "github.com/foo/bar"))
+	if exists("github.com/foo") || !exists("github.com/qux/baz") {
+		t.Error("github.com/foo kept or github.com/qux/baz removed")
+	}
+
+	// every parent up to src goes, src stays even when empty
+	for _, repo := range []string{"github.com/qux/baz", "gitlab.com/group/sub/project"} {
+		if err := os.RemoveAll(filepath.Join(src, repo)); err != nil {
+			t.Fatal(err)
+		}
+		removeEmptyParents(src, filepath.Join(src, repo))
+	}
+	if exists("github.com") || exists("gitlab.com") || !exists(".") {
+		t.Error("empty parents kept or src removed")
+	}
+
+	// a trailing slash on src does not let it go
+	if err := os.MkdirAll(filepath.Join(src, "x.org/a/b"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.RemoveAll(filepath.Join(src, "x.org/a/b")); err != nil {
+		t.Fatal(err)
+	}
+	removeEmptyParents(src+string(filepath.Separator), filepath.Join(src, "x.org/a/b"))
+	if exists("x.org") || !exists(".") {
+		t.Error("x.org kept or src removed")
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import "fmt"
+
+// shellFunctions define srccd, which clones a repository if needed and
+// changes into it, e.g. in ~/.bashrc
+//
+//	eval "$(src_git_clone -shell bash)"
+var shellFunctions = map[string]string{
+	"sh": `srccd() {
+	local dir
+	dir=$(src_git_clone -print-path "$@") && cd "$dir"
+}
+`,
+	"fish": `function srccd
+	set -l dir (src_git_clone -print-path $argv); and cd $dir
+end
+`,
+}
+
+func shellFunction(shell string) (string, error) {
+	switch shell {
+	case "bash", "zsh":
+		shell = "sh"
+	}
+	f, ok := shellFunctions[shell]
+	if !ok {
+		return "", fmt.Errorf("unsupported shell %q, want sh, bash, zsh or fish", shell)
+	}
+	return f, nil
+}
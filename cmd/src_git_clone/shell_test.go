@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestMain runs main instead of the tests when the test binary is
+// started by runMain.
+func TestMain(m *testing.M) {
+	if os.Getenv("SRC_GIT_CLONE_TEST_MAIN") == "1" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runMain runs src_git_clone args with SRC_ROOT set to src, and
+// https://example.com/ rewritten to the local directory upstream.
+func runMain(t *testing.T, src, upstream string, args ...string) (stdout, stderr string, err error) {
+	t.Helper()
+	gitConfig := filepath.Join(t.TempDir(), "gitconfig")
+	config := fmt.Sprintf("[url \"file://%s/\"]\n\tinsteadOf = https://example.com/\n", filepath.ToSlash(upstream))
+	if err := os.WriteFile(gitConfig, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Dir = t.TempDir()
+	cmd.Env = append(os.Environ(),
+		"SRC_GIT_CLONE_TEST_MAIN=1",
+		"SRC_ROOT="+src,
+		"GIT_CONFIG_GLOBAL="+gitConfig,
+		"GIT_CONFIG_NOSYSTEM=1",
+	)
+	var outBuf, errBuf bytes.Buffer
+	cmd.Stdout = &outBuf
+	cmd.Stderr = &errBuf
+	err = cmd.Run()
+	return outBuf.String(), errBuf.String(), err
+}
+
+func TestShellFunction(t *testing.T) {
+	tests := []struct {
+		shell string
+		want  string
+	}{
+		{"sh", `dir=$(src_git_clone -print-path "$@") && cd "$dir"`},
+		{"bash", `dir=$(src_git_clone -print-path "$@") && cd "$dir"`},
+		{"zsh", `dir=$(src_git_clone -print-path "$@") && cd "$dir"`},
+		{"fish", `set -l dir (src_git_clone -print-path $argv); and cd $dir`},
+		{"powershell", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		got, err := shellFunction(tt.shell)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("shellFunction(%q) = %q, want an error", tt.shell, got)
+			}
+			continue
+		}
+		if err != nil || !strings.Contains(got, tt.want) {
+			t.Errorf("shellFunction(%q) = %q, %v, want it to contain %q", tt.shell, got, err, tt.want)
+		}
+	}
+}
+
+func TestPrintPath(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	upstream := t.TempDir()
+	newUpstream(t, filepath.Join(upstream, "foo", "bar.git"))
+	src := t.TempDir()
+	target := filepath.Join(src, "example.com", "foo", "bar")
+
+	// cloning: git output goes to stderr, stdout is left to the path
+	stdout, stderr, err := runMain(t, src, upstream, "-print-path", "https://example.com/foo/bar.git")
+	if err != nil {
+		t.Fatalf("%v: %s", err, stderr)
+	}
+	if stdout != target+"\n" {
+		t.Errorf("stdout %q, want %q", stdout, target+"\n")
+	}
+	if !strings.Contains(stderr, "Cloning into") {
+		t.Errorf("stderr %q, want the git clone output", stderr)
+	}
+	if _, err := os.Stat(filepath.Join(target, "README")); err != nil {
+		t.Error(err)
+	}
+
+	// an existing clone only prints the path
+	stdout, stderr, err = runMain(t, src, upstream, "-print-path", "https://example.com/foo/bar")
+	if err != nil || stdout != target+"\n" {
+		t.Errorf("existing clone: stdout %q, %v: %s", stdout, err, stderr)
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+)
+
+// repoStatus is the state of a working tree relative to its upstream.
+type repoStatus struct {
+	Repo     string `json:"repo"`
+	Branch   string `json:"branch,omitempty"`
+	Upstream string `json:"upstream,omitempty"`
+	Dirty    int    `json:"dirty"`
+	Ahead    int    `json:"ahead"`
+	Behind   int    `json:"behind"`
+	Bare     bool   `json:"bare,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// parseStatus reads the output of git status --porcelain=v2 --branch,
+// Dirty counts the changed and untracked paths.
+func parseStatus(output string) (repoStatus, error) {
+	var s repoStatus
+	for _, line := range strings.Split(output, "\n") {
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, "# ") {
+			s.Dirty++
+			continue
+		}
+		f := strings.Fields(line[2:])
+		if len(f) < 2 {
+			continue
+		}
+		switch f[0] {
+		case "branch.head":
+			s.Branch = f[1]
+		case "branch.upstream":
+			s.Upstream = f[1]
+		case "branch.ab":
+			if len(f) != 3 {
+				return s, fmt.Errorf("invalid line %q", line)
+			}
+			var err error
+			if s.Ahead, err = strconv.Atoi(strings.TrimPrefix(f[1], "+")); err != nil {
+				return s, fmt.Errorf("invalid line %q", line)
+			}
+			if s.Behind, err = strconv.Atoi(strings.TrimPrefix(f[2], "-")); err != nil {
+				return s, fmt.Errorf("invalid line %q", line)
+			}
+		}
+	}
+	return s, nil
+}
+
+// fetchArgs are the git arguments updating dir from its origin. A bare
+// clone has no fetch refspec, its branches are updated in place.
+func fetchArgs(dir string) []string {
+	if !isBareRepo(dir) {
+		return []string{"fetch", "--quiet"}
+	}
+	if mirror, _ := gitOutput(dir, "config", "--bool", "remote.origin.mirror"); mirror == "true" {
+		return []string{"fetch", "--quiet", "--prune", "origin"}
+	}
+	return []string{"fetch", "--quiet", "--prune", "origin", "+refs/heads/*:refs/heads/*"}
+}
+
+func statusOf(dir string) (repoStatus, error) {
+	if isBareRepo(dir) {
+		// no branch on a detached HEAD
+		branch, _ := gitOutput(dir, "symbolic-ref", "--quiet", "--short", "HEAD")
+		return repoStatus{Branch: branch, Bare: true}, nil
+	}
+	output, err := gitOutput(dir, "status", "--porcelain=v2", "--branch")
+	if err != nil {
+		return repoStatus{}, err
+	}
+	return parseStatus(output)
+}
+
+// syncRepo fetches and fast-forwards a clean tree tracking an
+// upstream, a dirty tree or a bare repository is only fetched.
+func syncRepo(dir string) (repoStatus, error) {
+	if _, err := gitOutput(dir, fetchArgs(dir)...); err != nil {
+		s, _ := statusOf(dir)
+		return s, err
+	}
+	s, err := statusOf(dir)
+	if err != nil || s.Bare || s.Upstream == "" || s.Dirty > 0 || s.Behind == 0 {
+		return s, err
+	}
+	if _, err := gitOutput(dir, "merge", "--ff-only", "--quiet", "@{upstream}"); err != nil {
+		return s, err
+	}
+	return statusOf(dir)
+}
+
+// eachRepo runs f on every repository with at most concurrency at once
+// and returns the results in the order of repos.
+func eachRepo(src string, repos []string, concurrency int, f func(dir string) (repoStatus, error)) []repoStatus {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	results := make([]repoStatus, len(repos))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, repo := range repos {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, repo string) {
+			defer func() { <-sem; wg.Done() }()
+			s, err := f(filepath.Join(src, filepath.FromSlash(repo)))
+			if err != nil {
+				s.Error = err.Error()
+			}
+			s.Repo = repo
+			results[i] = s
+		}(i, repo)
+	}
+	wg.Wait()
+	return results
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
+
+// writeStatus prints a table with the first line of the errors, or
+// JSON with all of it.
+func writeStatus(w io.Writer, results []repoStatus, format string) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(results)
+	case "table":
+		var buf bytes.Buffer
+		tw := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(tw, "REPO\tBRANCH\tDIRTY\tAHEAD\tBEHIND\tERROR")
+		for _, s := range results {
+			branch := s.Branch
+			if s.Bare {
+				branch += " (bare)"
+			}
+			_, _ = fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%d\t%s\n", s.Repo, branch, s.Dirty, s.Ahead, s.Behind, firstLine(s.Error))
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+		// the padding of an empty error column
+		for _, line := range strings.SplitAfter(buf.String(), "\n") {
+			if line == "" {
+				continue
+			}
+			if _, err := io.WriteString(w, strings.TrimRight(line, " \n")+"\n"); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown format %q, want table or json", format)
+}
+
+func statusMain(args []string) {
+	walkMain("status", args, statusOf)
+}
+
+func syncMain(args []string) {
+	walkMain("sync", args, syncRepo)
+}
+
+// walkMain runs f on the repositories matching the optional query and
+// exits non-zero if any failed.
+func walkMain(name string, args []string, f func(dir string) (repoStatus, error)) {
+	fs := flag.NewFlagSet("src_git_clone "+name, flag.ExitOnError)
+	format := fs.String("format", "table", "output format: table or json")
+	concurrency := fs.Int("concurrency", 8, "number of repositories processed at once")
+	fs.Usage = func() {
+		_, _ = fmt.Fprintf(fs.Output(), "usage: src_git_clone %s [flags] [query]\n", name)
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() > 1 || *format != "table" && *format != "json" {
+		fs.Usage()
+		os.Exit(2)
+	}
+	src, err := findSrc()
+	if err != nil {
+		panic(err)
+	}
+	repos, err := walkRepos(src)
+	if err != nil {
+		panic(err)
+	}
+	if fs.NArg() == 1 {
+		repos = filterRepos(repos, fs.Arg(0))
+	}
+	results := eachRepo(src, repos, *concurrency, f)
+	if err := writeStatus(os.Stdout, results, *format); err != nil {
+		panic(err)
+	}
+	for _, s := range results {
+		if s.Error != "" {
+			os.Exit(1)
+		}
+	}
+}
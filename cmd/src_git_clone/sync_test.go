@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseStatus(t *testing.T) {
+	tests := []struct {
+		output string
+		want   repoStatus
+	}{
+		{
+			output: `# branch.oid 1b2c3d
+# branch.head main
+# branch.upstream origin/main
+# branch.ab +2 -3
+1 .M N... 100644 100644 100644 aaa bbb main.go
+? notes.txt
+`,
+			want: repoStatus{Branch: "main", Upstream: "origin/main", Dirty: 2, Ahead: 2, Behind: 3},
+		},
+		{
+			output: "# branch.oid 1b2c3d\n# branch.head (detached)\n",
+			want:   repoStatus{Branch: "(detached)"},
+		},
+		{
+			output: "# branch.oid (initial)\n# branch.head main\n",
+			want:   repoStatus{Branch: "main"},
+		},
+	}
+	for _, tt := range tests {
+		got, err := parseStatus(tt.output)
+		if err != nil {
+			t.Errorf("parseStatus(%q): %v", tt.output, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseStatus(%q) = %+v, want %+v", tt.output, got, tt.want)
+		}
+	}
+	if _, err := parseStatus("# branch.ab +x -1\n"); err == nil {
+		t.Error("parseStatus accepted an invalid branch.ab line")
+	}
+}
+
+func TestWriteStatus(t *testing.T) {
+	results := []repoStatus{
+		{Repo: "github.com/foo/bar", Branch: "main", Upstream: "origin/main", Dirty: 1, Behind: 4},
+		{Repo: "x.org/a/b", Error: "git fetch: fatal: unreachable\nmore detail"},
+		{Repo: "x.org/a/mirror", Branch: "main", Bare: true},
+	}
+	var buf bytes.Buffer
+	if err := writeStatus(&buf, results, "table"); err != nil {
+		t.Fatal(err)
+	}
+	want := `REPO                BRANCH       DIRTY  AHEAD  BEHIND  ERROR
+github.com/foo/bar  main         1      0      4
+x.org/a/b                        0      0      0       git fetch: fatal: unreachable
+x.org/a/mirror      main (bare)  0      0      0
+`
+	if buf.String() != want {
+		t.Errorf("table:\n%s\nwant:\n%s", buf.String(), want)
+	}
+	buf.Reset()
+	if err := writeStatus(&buf, results[1:2], "json"); err != nil {
+		t.Fatal(err)
+	}
+	want = `[
+  {
+    "repo": "x.org/a/b",
+    "dirty": 0,
+    "ahead": 0,
+    "behind": 0,
+    "error": "git fetch: fatal: unreachable\nmore detail"
+  }
+]
+`
+	if buf.String() != want {
+		t.Errorf("json:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+// pushCommit commits name to upstream through a throwaway clone and
+// returns the new commit.
+func pushCommit(t *testing.T, upstream, name string) string {
+	t.Helper()
+	work := filepath.Join(t.TempDir(), "work")
+	runGit(t, ".", "clone", "--quiet", upstream, work)
+	commitFile(t, work, name, name+"\n")
+	runGit(t, work, "push", "--quiet", "origin", "HEAD")
+	return runGit(t, work, "rev-parse", "HEAD")
+}
+
+func TestSyncRepo(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	dir := t.TempDir()
+	upstream := filepath.Join(dir, "upstream.git")
+	newUpstream(t, upstream)
+	clean := filepath.Join(dir, "clean")
+	dirty := filepath.Join(dir, "dirty")
+	runGit(t, dir, "clone", "--quiet", upstream, clean)
+	runGit(t, dir, "clone", "--quiet", upstream, dirty)
+	if err := os.WriteFile(filepath.Join(dirty, "README"), []byte("local edit\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	before := runGit(t, dirty, "rev-parse", "HEAD")
+	head := pushCommit(t, upstream, "NEW")
+
+	// a clean tree is fast-forwarded
+	s, err := syncRepo(clean)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (repoStatus{Branch: "main", Upstream: "origin/main"}); s != want {
+		t.Errorf("clean: %+v, want %+v", s, want)
+	}
+	if got := runGit(t, clean, "rev-parse", "HEAD"); got != head {
+		t.Errorf("clean: HEAD %s, want %s", got, head)
+	}
+
+	// a dirty tree is fetched and left alone
+	s, err = syncRepo(dirty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (repoStatus{Branch: "main", Upstream: "origin/main", Dirty: 1, Behind: 1}); s != want {
+		t.Errorf("dirty: %+v, want %+v", s, want)
+	}
+	if got := runGit(t, dirty, "rev-parse", "HEAD"); got != before {
+		t.Errorf("dirty: HEAD moved to %s", got)
+	}
+	if b, err := os.ReadFile(filepath.Join(dirty, "README")); err != nil || string(b) != "local edit\n" {
+		t.Errorf("dirty: README %q, %v", b, err)
+	}
+	if _, err := os.Stat(filepath.Join(dirty, "NEW")); err == nil {
+		t.Error("dirty: NEW checked out")
+	}
+}
+
+func TestSyncRepoBare(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	dir := t.TempDir()
+	upstream := filepath.Join(dir, "upstream.git")
+	newUpstream(t, upstream)
+	bare := filepath.Join(dir, "bare.git")
+	mirror := filepath.Join(dir, "mirror.git")
+	runGit(t, dir, "clone", "--quiet", "--bare", upstream, bare)
+	runGit(t, dir, "clone", "--quiet", "--mirror", upstream, mirror)
+
+	if got, want := fetchArgs(bare), []string{"fetch", "--quiet", "--prune", "origin", "+refs/heads/*:refs/heads/*"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("bare: fetchArgs %q, want %q", got, want)
+	}
+	if got, want := fetchArgs(mirror), []string{"fetch", "--quiet", "--prune", "origin"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("mirror: fetchArgs %q, want %q", got, want)
+	}
+
+	head := pushCommit(t, upstream, "NEW")
+	runGit(t, upstream, "branch", "topic", head)
+	for _, repo := range []string{bare, mirror} {
+		s, err := syncRepo(repo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := (repoStatus{Branch: "main", Bare: true}); s != want {
+			t.Errorf("%s: %+v, want %+v", filepath.Base(repo), s, want)
+		}
+		for _, ref := range []string{"refs/heads/main", "refs/heads/topic"} {
+			if got := runGit(t, repo, "rev-parse", ref); got != head {
+				t.Errorf("%s: %s at %s, want %s", filepath.Base(repo), ref, got, head)
+			}
+		}
+	}
+
+	// a deleted branch is pruned
+	runGit(t, upstream, "branch", "--quiet", "-D", "topic")
+	for _, repo := range []string{bare, mirror} {
+		if _, err := syncRepo(repo); err != nil {
+			t.Fatal(err)
+		}
+		if refs := runGit(t, repo, "for-each-ref", "--format=%(refname)", "refs/heads/"); refs != "refs/heads/main" {
+			t.Errorf("%s: branches %q, want refs/heads/main", filepath.Base(repo), refs)
+		}
+	}
+}
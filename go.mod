@@ -2,10 +2,15 @@ module github.com/shanexu/sillytools
 
 go 1.19
 
-require github.com/crewjam/rfc5424 v0.1.0
+require (
+	github.com/crewjam/rfc5424 v0.1.0
+	github.com/oschwald/maxminddb-golang v1.10.0
+	github.com/segmentio/kafka-go v0.4.38
+	golang.org/x/sys v0.0.0-20220804214406-8e32c043e418
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require (
 	github.com/klauspost/compress v1.15.9 // indirect
 	github.com/pierrec/lz4/v4 v4.1.15 // indirect
-	github.com/segmentio/kafka-go v0.4.38 // indirect
 )